@@ -0,0 +1,135 @@
+package client
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credential provides a secret used to authenticate against moogsoft.
+type Credential interface {
+	Value() (string, error)
+}
+
+// StaticCredential is a secret known at startup.
+type StaticCredential string
+
+func (c StaticCredential) Value() (string, error) {
+	return string(c), nil
+}
+
+// FileCredential reads a secret from a file, reading it again whenever the
+// file is modified so rotated credentials are picked up without a restart.
+type FileCredential struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	value   string
+}
+
+func NewFileCredential(path string) *FileCredential {
+	return &FileCredential{path: path}
+}
+
+func (c *FileCredential) Value() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return "", err
+	}
+
+	if info.ModTime().Equal(c.modTime) {
+		return c.value, nil
+	}
+
+	content, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return "", err
+	}
+
+	c.value = strings.TrimSpace(string(content))
+	c.modTime = info.ModTime()
+
+	return c.value, nil
+}
+
+// Authenticator adds the moogsoft credentials to a request.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// BasicTokenAuth sends already base64 encoded basic auth credentials.
+type BasicTokenAuth struct {
+	Token Credential
+}
+
+func (a BasicTokenAuth) Authenticate(req *http.Request) error {
+	token, err := a.Token.Value()
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", token))
+	return nil
+}
+
+// BasicAuth sends the username and password as basic auth credentials.
+type BasicAuth struct {
+	Username Credential
+	Password Credential
+}
+
+func (a BasicAuth) Authenticate(req *http.Request) error {
+	username, err := a.Username.Value()
+	if err != nil {
+		return err
+	}
+
+	password, err := a.Password.Value()
+	if err != nil {
+		return err
+	}
+
+	credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", credentials))
+	return nil
+}
+
+// BearerAuth sends the token as a bearer token.
+type BearerAuth struct {
+	Token Credential
+}
+
+func (a BearerAuth) Authenticate(req *http.Request) error {
+	token, err := a.Token.Value()
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return nil
+}
+
+// HeaderAuth sends the token as is in a custom header, usually an API key.
+type HeaderAuth struct {
+	Header string
+	Token  Credential
+}
+
+func (a HeaderAuth) Authenticate(req *http.Request) error {
+	token, err := a.Token.Value()
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(a.Header, token)
+	return nil
+}
@@ -0,0 +1,79 @@
+package client_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("Authenticators", func() {
+	var req *http.Request
+
+	BeforeEach(func() {
+		req, _ = http.NewRequest("POST", "http://moogsoft.example.com", nil)
+	})
+
+	It("Should send a pre encoded basic token", func() {
+		Expect(BasicTokenAuth{Token: StaticCredential("dXNlcjpwYXNz")}.Authenticate(req)).Should(Succeed())
+		Expect(req.Header.Get("Authorization")).Should(Equal("Basic dXNlcjpwYXNz"))
+	})
+
+	It("Should encode the username and password", func() {
+		auth := BasicAuth{Username: StaticCredential("user"), Password: StaticCredential("pass")}
+		Expect(auth.Authenticate(req)).Should(Succeed())
+		Expect(req.Header.Get("Authorization")).Should(Equal("Basic dXNlcjpwYXNz"))
+	})
+
+	It("Should send a bearer token", func() {
+		Expect(BearerAuth{Token: StaticCredential("some-token")}.Authenticate(req)).Should(Succeed())
+		Expect(req.Header.Get("Authorization")).Should(Equal("Bearer some-token"))
+	})
+
+	It("Should send the token in a custom header", func() {
+		Expect(HeaderAuth{Header: "X-Api-Key", Token: StaticCredential("some-key")}.Authenticate(req)).Should(Succeed())
+		Expect(req.Header.Get("X-Api-Key")).Should(Equal("some-key"))
+		Expect(req.Header.Get("Authorization")).Should(BeEmpty())
+	})
+})
+
+var _ = Describe("FileCredential", func() {
+	var path string
+
+	BeforeEach(func() {
+		f, err := ioutil.TempFile("", "moogsoft-token")
+		Expect(err).ShouldNot(HaveOccurred())
+		f.WriteString("first-token\n")
+		f.Close()
+		path = f.Name()
+	})
+
+	AfterEach(func() {
+		os.Remove(path)
+	})
+
+	It("Should read the secret from the file", func() {
+		Expect(NewFileCredential(path).Value()).Should(Equal("first-token"))
+	})
+
+	It("Should read the file again when it is rotated", func() {
+		credential := NewFileCredential(path)
+		Expect(credential.Value()).Should(Equal("first-token"))
+
+		Expect(ioutil.WriteFile(path, []byte("second-token"), 0600)).Should(Succeed())
+		later := time.Now().Add(time.Minute)
+		Expect(os.Chtimes(path, later, later)).Should(Succeed())
+
+		Expect(credential.Value()).Should(Equal("second-token"))
+	})
+
+	It("Should return an error when the file is missing", func() {
+		_, err := NewFileCredential("/does/not/exist").Value()
+		Expect(err).Should(HaveOccurred())
+	})
+})
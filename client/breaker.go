@@ -0,0 +1,131 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	CLOSED BreakerState = iota
+	HALF_OPEN
+	OPEN
+)
+
+func (s BreakerState) String() string {
+	return [...]string{"closed", "half-open", "open"}[s]
+}
+
+// CircuitBreaker stops deliveries to moogsoft after consecutive failures.
+// Once the cooldown is over a single probe request is let through, closing
+// the breaker again if it succeeds.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker returns a breaker that opens after threshold consecutive
+// failures and waits cooldown before probing moogsoft again.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow reports whether a request can be sent. A nil breaker allows every
+// request.
+func (b *CircuitBreaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == OPEN && time.Since(b.openedAt) >= b.cooldown {
+		b.state = HALF_OPEN
+	}
+
+	switch b.state {
+	case CLOSED:
+		return true
+	case HALF_OPEN:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return false
+	}
+}
+
+// Success records a successful delivery and closes the breaker.
+func (b *CircuitBreaker) Success() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = CLOSED
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure records a failed delivery, opening the breaker when the threshold
+// is reached or when the half-open probe fails.
+func (b *CircuitBreaker) Failure() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+
+	if b.state == HALF_OPEN || b.failures >= b.threshold {
+		b.state = OPEN
+		b.openedAt = time.Now()
+	}
+}
+
+// Release gives back a request that was allowed but never sent, so the next
+// one can probe moogsoft when the breaker is half-open.
+func (b *CircuitBreaker) Release() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// State returns the current breaker state.
+func (b *CircuitBreaker) State() BreakerState {
+	if b == nil {
+		return CLOSED
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == OPEN && time.Since(b.openedAt) >= b.cooldown {
+		return HALF_OPEN
+	}
+
+	return b.state
+}
@@ -0,0 +1,266 @@
+package client_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("CircuitBreaker", func() {
+	var breaker *CircuitBreaker
+
+	BeforeEach(func() {
+		breaker = NewCircuitBreaker(2, 50*time.Millisecond)
+	})
+
+	It("Should open after consecutive failures", func() {
+		breaker.Failure()
+		Expect(breaker.Allow()).Should(BeTrue())
+
+		breaker.Failure()
+		Expect(breaker.State()).Should(Equal(OPEN))
+		Expect(breaker.Allow()).Should(BeFalse())
+	})
+
+	It("Should reset the failures after a success", func() {
+		breaker.Failure()
+		breaker.Success()
+		breaker.Failure()
+
+		Expect(breaker.State()).Should(Equal(CLOSED))
+	})
+
+	Context("when the cooldown is over", func() {
+		BeforeEach(func() {
+			breaker.Failure()
+			breaker.Failure()
+			time.Sleep(60 * time.Millisecond)
+		})
+
+		It("Should let a single probe through", func() {
+			Expect(breaker.State()).Should(Equal(HALF_OPEN))
+			Expect(breaker.Allow()).Should(BeTrue())
+			Expect(breaker.Allow()).Should(BeFalse())
+		})
+
+		It("Should close when the probe succeeds", func() {
+			breaker.Allow()
+			breaker.Success()
+
+			Expect(breaker.State()).Should(Equal(CLOSED))
+		})
+
+		It("Should open again when the probe fails", func() {
+			breaker.Allow()
+			breaker.Failure()
+
+			Expect(breaker.State()).Should(Equal(OPEN))
+		})
+	})
+})
+
+var _ = Describe("Client delivery failures", func() {
+	var client Client
+	var moogsoftServer FakeMoogsoftServer
+	var token string
+
+	prometheusEvent := `{
+    "alerts": [
+      {
+        "status": "firing",
+        "labels": { "alertname": "SomeAlert", "service": "probe", "severity": "warning" },
+        "annotations": { "description": "some alert description" },
+        "startsAt": "2018-10-23T16:44:39.901211833Z"
+      }
+    ]
+  }`
+
+	gin.SetMode(gin.ReleaseMode)
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+		token = moogsoftServer.GetToken()
+
+		client = Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+			Breaker:        NewCircuitBreaker(1, time.Hour),
+			Queue:          NewRetryQueue(10, 2),
+		}
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+	})
+
+	Context("when moogsoft is failing", func() {
+		BeforeEach(func() { moogsoftServer.FailWith = http.StatusBadGateway })
+
+		It("Should queue the events and open the breaker", func() {
+			statusCode, err := client.SendEvents(prometheusEvent, token)
+			Expect(err).Should(BeNil())
+			Expect(statusCode).Should(Equal(http.StatusAccepted))
+
+			Expect(client.Breaker.State()).Should(Equal(OPEN))
+			Expect(client.Queue.Len()).Should(Equal(1))
+		})
+
+		It("Should short-circuit deliveries while the breaker is open", func() {
+			client.SendEvents(prometheusEvent, token)
+			moogsoftServer.FailWith = 0
+
+			statusCode, err := client.SendEvents(prometheusEvent, token)
+			Expect(err).Should(BeNil())
+			Expect(statusCode).Should(Equal(http.StatusAccepted))
+
+			Expect(moogsoftServer.ReceivedEvents).Should(BeEmpty())
+			Expect(client.Queue.Len()).Should(Equal(2))
+		})
+
+		It("Should dead letter requests after exhausting their attempts", func() {
+			client.Breaker = nil
+			client.SendEvents(prometheusEvent, token)
+
+			client.RetryQueued()
+			Expect(client.Queue.Len()).Should(Equal(1))
+
+			client.RetryQueued()
+			Expect(client.Queue.Len()).Should(Equal(0))
+			Expect(client.Queue.DeadLetters()).Should(Equal(int64(1)))
+		})
+	})
+
+	Context("when moogsoft recovers", func() {
+		It("Should deliver the queued events", func() {
+			client.Breaker = NewCircuitBreaker(1, 0)
+			moogsoftServer.FailWith = http.StatusBadGateway
+			client.SendEvents(prometheusEvent, token)
+			client.SendEvents(prometheusEvent, token)
+
+			moogsoftServer.FailWith = 0
+			client.RetryQueued()
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(2))
+			Expect(client.Queue.Len()).Should(Equal(0))
+			Expect(client.Breaker.State()).Should(Equal(CLOSED))
+		})
+
+		It("Should only record the queued events once delivered", func() {
+			client.Breaker = NewCircuitBreaker(1, 0)
+			client.Registry = NewRegistry()
+			moogsoftServer.FailWith = http.StatusBadGateway
+			client.SendEvents(prometheusEvent, token)
+			Expect(client.Registry.Len()).Should(Equal(0))
+
+			moogsoftServer.FailWith = 0
+			client.RetryQueued()
+
+			Expect(client.Registry.Len()).Should(Equal(1))
+		})
+
+		It("Should not record the queued events moogsoft rejects", func() {
+			client.Breaker = NewCircuitBreaker(1, 0)
+			client.Registry = NewRegistry()
+			moogsoftServer.FailWith = http.StatusBadGateway
+			client.SendEvents(prometheusEvent, token)
+
+			moogsoftServer.FailWith = http.StatusBadRequest
+			client.RetryQueued()
+
+			Expect(client.Queue.Len()).Should(Equal(0))
+			Expect(client.Registry.Len()).Should(Equal(0))
+		})
+
+		It("Should queue new events behind the pending ones", func() {
+			client.Breaker = NewCircuitBreaker(1, 0)
+			moogsoftServer.FailWith = http.StatusBadGateway
+			client.SendEvents(prometheusEvent, token)
+
+			moogsoftServer.FailWith = 0
+			resolvedEvent := strings.Replace(prometheusEvent, `"status": "firing"`, `"status": "resolved"`, 1)
+			statusCode, err := client.SendEvents(resolvedEvent, token)
+			Expect(err).Should(BeNil())
+			Expect(statusCode).Should(Equal(http.StatusAccepted))
+			Expect(moogsoftServer.ReceivedEvents).Should(BeEmpty())
+
+			client.RetryQueued()
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(2))
+			Expect(moogsoftServer.ReceivedEvents[0].Severity).Should(Equal(MAJOR))
+			Expect(moogsoftServer.ReceivedEvents[1].Severity).Should(Equal(CLEAR))
+		})
+	})
+
+	Context("when a retry is still in flight", func() {
+		It("Should queue new events behind it", func() {
+			client.Breaker = nil
+			moogsoftServer.FailWith = http.StatusBadGateway
+			client.SendEvents(prometheusEvent, token)
+
+			transport := &blockingTransport{started: make(chan struct{}), release: make(chan struct{})}
+			client.HTTPClient = &http.Client{Transport: transport}
+			retried := make(chan struct{})
+			go func() {
+				defer close(retried)
+				client.RetryQueued()
+			}()
+			<-transport.started
+
+			moogsoftServer.FailWith = 0
+			resolvedEvent := strings.Replace(prometheusEvent, `"status": "firing"`, `"status": "resolved"`, 1)
+			statusCode, err := client.SendEvents(resolvedEvent, token)
+
+			close(transport.release)
+			<-retried
+			Expect(err).Should(BeNil())
+			Expect(statusCode).Should(Equal(http.StatusAccepted))
+			Expect(client.Queue.Len()).Should(Equal(2))
+
+			client.RetryQueued()
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(2))
+			Expect(moogsoftServer.ReceivedEvents[0].Severity).Should(Equal(MAJOR))
+			Expect(moogsoftServer.ReceivedEvents[1].Severity).Should(Equal(CLEAR))
+		})
+	})
+
+	Context("when there is no retry queue", func() {
+		It("Should return the moogsoft error", func() {
+			client.Queue = nil
+			moogsoftServer.FailWith = http.StatusBadGateway
+
+			statusCode, _ := client.SendEvents(prometheusEvent, token)
+			Expect(statusCode).Should(Equal(http.StatusBadGateway))
+
+			statusCode, err := client.SendEvents(prometheusEvent, token)
+			Expect(err).Should(Equal(ErrCircuitOpen))
+			Expect(statusCode).Should(Equal(http.StatusServiceUnavailable))
+		})
+	})
+})
+
+// blockingTransport holds the first request until release is closed,
+// signaling started once it is in flight, and then fails it.
+type blockingTransport struct {
+	started chan struct{}
+	release chan struct{}
+	held    int32
+}
+
+func (t *blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if atomic.CompareAndSwapInt32(&t.held, 0, 1) {
+		close(t.started)
+		<-t.release
+		return &http.Response{StatusCode: http.StatusBadGateway, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+	}
+
+	return http.DefaultTransport.RoundTrip(req)
+}
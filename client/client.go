@@ -2,13 +2,16 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"io/ioutil"
+	"log/slog"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -22,8 +25,22 @@ const (
 	CRITICAL
 )
 
+var severityNames = [...]string{"CLEAR", "INDETERMINATE", "MINOR", "MAJOR", "CRITICAL"}
+
 func (s Severity) String() string {
-	return [...]string{"CLEAR", "INDETERMINATE", "MINOR", "MAJOR", "CRITICAL"}[s]
+	return severityNames[s]
+}
+
+// ParseSeverity returns the severity named name, either CLEAR, MAJOR... or
+// its number.
+func ParseSeverity(name string) (Severity, error) {
+	for i, severityName := range severityNames {
+		if strings.EqualFold(name, severityName) || name == strconv.Itoa(i) {
+			return Severity(i), nil
+		}
+	}
+
+	return INDETERMINATE, fmt.Errorf("Unknown severity: %s", name)
 }
 
 // Moogsoft client
@@ -32,11 +49,81 @@ type Client struct {
 	URL               string
 	EventsEndpoint    string
 	XMattersGroupName string
+
+	// Limiter throttles the requests sent to moogsoft, nil disables it.
+	Limiter *RateLimiter
+	// Breaker stops deliveries while moogsoft is failing, nil disables it.
+	Breaker *CircuitBreaker
+	// Queue keeps failed deliveries to be retried later, nil disables it.
+	Queue *RetryQueue
+	// HTTPClient sends the requests to moogsoft, defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+	// Auth authenticates the requests to moogsoft, when nil the token given
+	// to SendEvents is sent as basic auth credentials.
+	Auth Authenticator
+	// RedactKeys are the labels and annotations whose values are hidden when
+	// logging the received payloads.
+	RedactKeys []string
+	// Registry keeps track of the alerts sent to moogsoft, nil disables it.
+	Registry *Registry
+	// Heartbeats tracks the heartbeat alerts instead of forwarding them, nil
+	// forwards every alert.
+	Heartbeats *HeartbeatMonitor
+	// Maintenance drops, downgrades or tags the alerts in maintenance, nil
+	// disables it.
+	Maintenance *MaintenanceSchedule
+	// Filters keep out the alerts not accepted by every filter, e.g. the
+	// global and the destination ones.
+	Filters []*LabelFilter
+	// TenantFilters filter the alerts by the value of their TenantLabel.
+	TenantLabel   string
+	TenantFilters map[string]*LabelFilter
+	// Relabel rules are applied in order to every alert before it is mapped,
+	// they must be validated first.
+	Relabel []RelabelConfig
+	// Lookups enrich the events from static tables, in order.
+	Lookups []*LookupTable
+	// Enrichments enrich the events from HTTP services, after the lookups.
+	Enrichments []*HTTPEnrichment
+	// IP derives the ip address and subnet of the events from their labels,
+	// nil only maps the bosh_job_ip of the bosh services.
+	IP *IPConfig
+	// Metrics sets where the metric values come from when the alerts carry
+	// none, nil only uses the grafana values.
+	Metrics *MetricConfig
+	// Description builds the event descriptions, nil uses the first of the
+	// description, summary or message annotations, or the alertname.
+	Description *DescriptionConfig
+	// CustomInfo selects the alert context sent in the event custom_info,
+	// nil sends none.
+	CustomInfo *CustomInfoConfig
+	// Silencer expires the alertmanager silences of the resolved alerts, nil
+	// leaves them until they end.
+	Silencer *Silencer
+
+	delivery deliveryStatus
+}
+
+var (
+	ErrCircuitOpen = errors.New("Circuit breaker is open, moogsoft is unavailable")
+	ErrQueueFull   = errors.New("Retry queue is full")
+	// ErrRequestCanceled is returned when the request is canceled, e.g. by
+	// the webhook timeout, before it could be sent to moogsoft. The sender
+	// retries it, so it is neither queued nor counted as a moogsoft failure.
+	ErrRequestCanceled = errors.New("Request canceled before it was sent to moogsoft")
+)
+
+// Destination returns the moogsoft url events are sent to.
+func (c *Client) Destination() string {
+	return fmt.Sprintf("%s%s", c.URL, c.EventsEndpoint)
 }
 
 // INPUT
 type PrometheusPayload struct {
-	Alerts []PrometheusAlert `json:"alerts"`
+	Alerts      []PrometheusAlert `json:"alerts"`
+	GroupKey    string            `json:"groupKey"`
+	ExternalURL string            `json:"externalURL"`
 }
 
 // INPUT
@@ -45,7 +132,25 @@ type PrometheusAlert struct {
 	Labels       map[string]string `json:"labels"`
 	Annotations  map[string]string `json:"annotations"`
 	StartsAt     string            `json:"startsAt"`
+	EndsAt       string            `json:"endsAt,omitempty"`
 	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint,omitempty"`
+
+	// Set from the webhook payload
+	GroupKey    string `json:"groupKey,omitempty"`
+	ExternalURL string `json:"externalURL,omitempty"`
+
+	// Only sent by grafana, OrgID is set from the webhook payload
+	OrgID        int64              `json:"orgId,omitempty"`
+	SilenceURL   string             `json:"silenceURL,omitempty"`
+	DashboardURL string             `json:"dashboardURL,omitempty"`
+	PanelURL     string             `json:"panelURL,omitempty"`
+	Values       map[string]float64 `json:"values,omitempty"`
+	ValueString  string             `json:"valueString,omitempty"`
+
+	// receivedLabels are the labels before relabelling, the ones alertmanager
+	// knows the alert by.
+	receivedLabels map[string]string
 }
 
 func (a PrometheusAlert) GetSeverity() Severity {
@@ -68,7 +173,7 @@ func (a PrometheusAlert) GetSeverity() Severity {
 func (a PrometheusAlert) GetAgentTime() string {
 	agentTime, err := time.Parse(time.RFC3339Nano, a.StartsAt)
 	if err != nil {
-		log.Println(err.Error())
+		slog.Warn("Invalid alert start time", "error", err.Error())
 	}
 
 	return strconv.FormatInt(agentTime.Unix(), 10)
@@ -102,28 +207,89 @@ type MoogsoftEvent struct {
 	AonIPAddress           string   `json:"aonIPAddress"`
 	AonIPSubnet            string   `json:"aonIPSubnet"`
 	AonJSONVersion         string   `json:"aonJSONversion"`
+
+	CustomInfo map[string]interface{} `json:"custom_info,omitempty"`
 }
 
 func (c *Client) SendEvents(payload string, token string) (int, error) {
-	var moogsoftEvents []MoogsoftEvent
+	return c.SendEventsContext(context.Background(), payload, token)
+}
+
+// SendEventsContext sends the alerts in the prometheus payload to moogsoft,
+// tagging the logs and the moogsoft request with the request id in ctx.
+func (c *Client) SendEventsContext(ctx context.Context, payload string, token string) (int, error) {
 	var prometheusPayload PrometheusPayload
-	if os.Getenv("DEBUG") != "" {
-		log.Println("Received payload: ", payload)
-	}
 
 	err := json.Unmarshal([]byte(payload), &prometheusPayload)
 	if err != nil {
+		loggerFor(ctx).Error("Invalid prometheus payload", "error", err.Error(), "payload_size", len(payload))
 		return 500, err
 	}
 
-	for _, alert := range prometheusPayload.Alerts {
-		event, err := c.eventFor(alert)
+	return c.SendAlerts(ctx, withGroup(prometheusPayload.Alerts, prometheusPayload.GroupKey, prometheusPayload.ExternalURL), token)
+}
+
+// SendAlerts maps the alerts to moogsoft events and sends them in a single
+// request.
+func (c *Client) SendAlerts(ctx context.Context, alerts []PrometheusAlert, token string) (int, error) {
+	var moogsoftEvents []MoogsoftEvent
+	var sentAlerts []PrometheusAlert
+	logger := loggerFor(ctx)
+	now := time.Now()
+
+	logger.Debug("Received payload", "alerts", redact(alerts, c.RedactKeys))
+
+	// The alerts are recorded as received, so the ones sent again from the
+	// registry are only relabelled once.
+	for _, received := range alerts {
+		alert := relabel(received, c.Relabel)
+
+		if c.Heartbeats.IsHeartbeat(alert) {
+			recovered, ok := c.Heartbeats.Observe(alert, now)
+			if !ok {
+				continue
+			}
+			logger.Info("Heartbeat received again", "alertname", alert.Labels["alertname"])
+			received, alert = recovered, relabel(recovered, c.Relabel)
+		} else if !c.accepts(alert) {
+			logger.Debug("Filtered out alert", "alertname", alert.Labels["alertname"])
+			continue
+		}
+
+		event, err := c.eventFor(ctx, alert)
 		if err != nil {
-			log.Println(err.Error())
+			logger.Warn(err.Error(), "alertname", alert.Labels["alertname"])
+		}
+
+		if event.AonMetricValue == "" {
+			if event.AonMetricValue, err = c.Metrics.queryValue(ctx, alert); err != nil {
+				logger.Warn("Unable to query the metric value", "signature", event.Signature, "error", err.Error())
+			}
+		}
+
+		if !c.enrich(ctx, &event, alert) {
+			logger.Info("Dropped alert missing in lookup table", "signature", event.Signature)
+			continue
+		}
+
+		if window, ok := c.Maintenance.windowFor(alert, now); ok {
+			var keep bool
+			if event, keep = window.apply(event, alert); !keep {
+				logger.Info("Dropped alert in maintenance", "signature", event.Signature, "maintenance_window", window.Name)
+				continue
+			}
 		}
 
 		moogsoftEvents = append(moogsoftEvents, event)
+		sentAlerts = append(sentAlerts, received)
+	}
+
+	// Nothing left to send once heartbeats, filtered alerts and alerts in
+	// maintenance are left out.
+	if len(alerts) > 0 && len(moogsoftEvents) == 0 {
+		return http.StatusOK, nil
 	}
+	alerts = sentAlerts
 
 	moogsoftPayload := MoogsoftPayload{
 		Events: moogsoftEvents,
@@ -133,25 +299,241 @@ func (c *Client) SendEvents(payload string, token string) (int, error) {
 		return 500, err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s%s", c.URL, c.EventsEndpoint), bytes.NewReader(rawData))
+	// Queued events are only recorded once the retry delivers them.
+	delivered := func() {
+		if c.Registry == nil {
+			return
+		}
+		silenceIDs := resolvedSilences(c.Registry, moogsoftEvents, alerts)
+		if err := c.Registry.Record(moogsoftEvents, alerts, c.Destination()); err != nil {
+			logger.Error("Unable to save the alert registry", "error", err.Error())
+		}
+		if len(silenceIDs) > 0 {
+			// Alertmanager being slow must not hold the webhook or the retries.
+			go c.Silencer.expire(WithRequestID(context.Background(), RequestID(ctx)), silenceIDs)
+		}
+	}
+
+	return c.deliver(ctx, rawData, token, delivered)
+}
+
+// accepts reports whether the alert passes the client and tenant filters.
+func (c *Client) accepts(alert PrometheusAlert) bool {
+	for _, filter := range c.Filters {
+		if !filter.Accepts(alert.Labels) {
+			return false
+		}
+	}
+
+	if c.TenantLabel != "" {
+		return c.TenantFilters[alert.Labels[c.TenantLabel]].Accepts(alert.Labels)
+	}
+
+	return true
+}
+
+// RetryQueued retries the requests waiting in the retry queue until the
+// queue is empty or a delivery fails. It is not safe to run it concurrently.
+func (c *Client) RetryQueued() {
+	if c.Queue == nil {
+		return
+	}
+
+	for c.Queue.Len() > 0 && c.Breaker.Allow() {
+		// The request stays at the front of the queue until it is done, so
+		// the requests arriving meanwhile queue behind it.
+		request, _ := c.Queue.peek()
+
+		ctx := WithRequestID(context.Background(), request.requestID)
+		statusCode, err := c.post(ctx, request.payload, request.token)
+		if !deliveryFailed(statusCode, err) {
+			c.Breaker.Success()
+			c.Queue.remove()
+			// Moogsoft rejecting the request is not retried, but nothing
+			// was delivered either.
+			if request.delivered != nil && err == nil && statusCode < 300 {
+				request.delivered()
+			}
+			continue
+		}
+
+		c.Breaker.Failure()
+		if !c.Queue.failed() {
+			loggerFor(ctx).Error("Dropping request to moogsoft", "attempts", request.attempts+1, "status_code", statusCode)
+		}
+		return
+	}
+}
+
+// RunRetries retries the queued requests every interval until stop is closed.
+func (c *Client) RunRetries(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.RetryQueued()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// deliver posts the request to moogsoft, or queues it for a retry, calling
+// delivered once moogsoft accepted it.
+func (c *Client) deliver(ctx context.Context, rawData []byte, token string, delivered func()) (int, error) {
+	request := queuedRequest{payload: rawData, token: token, requestID: RequestID(ctx), delivered: delivered}
+
+	// Older requests are still waiting for a retry: queue behind them so a
+	// resolved event never overtakes the firing event it clears.
+	if c.Queue != nil && c.Queue.Len() > 0 {
+		if !c.Queue.push(request) {
+			loggerFor(ctx).Error("Retry queue is full, dropping request to moogsoft")
+			return http.StatusServiceUnavailable, ErrQueueFull
+		}
+		return http.StatusAccepted, nil
+	}
+
+	if !c.Breaker.Allow() {
+		return c.enqueue(ctx, request, http.StatusServiceUnavailable, ErrCircuitOpen)
+	}
+
+	statusCode, err := c.post(ctx, rawData, token)
+	if errors.Is(err, ErrRequestCanceled) {
+		c.Breaker.Release()
+		return statusCode, err
+	}
+	if deliveryFailed(statusCode, err) {
+		c.Breaker.Failure()
+		return c.enqueue(ctx, request, statusCode, err)
+	}
+
+	c.Breaker.Success()
+	if err == nil && statusCode < 300 {
+		delivered()
+	}
+
+	return statusCode, err
+}
+
+// enqueue stores a request that could not be delivered in the retry queue,
+// returning the original failure when there is no room for it.
+func (c *Client) enqueue(ctx context.Context, request queuedRequest, statusCode int, err error) (int, error) {
+	if c.Queue == nil {
+		return statusCode, err
+	}
+
+	if !c.Queue.push(request) {
+		loggerFor(ctx).Error("Retry queue is full, dropping request to moogsoft", "status_code", statusCode)
+		return http.StatusServiceUnavailable, ErrQueueFull
+	}
+
+	loggerFor(ctx).Warn("Delivery to moogsoft failed, request queued for retry", "status_code", statusCode)
+
+	return http.StatusAccepted, nil
+}
+
+func (c *Client) post(ctx context.Context, rawData []byte, token string) (int, error) {
+	req, err := http.NewRequest("POST", c.Destination(), bytes.NewReader(rawData))
 	if err != nil {
 		return 500, err
 	}
+	req = req.WithContext(ctx)
 
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", fmt.Sprintf("Basic %s", token))
-	res, err := http.DefaultClient.Do(req)
+	if requestID := RequestID(ctx); requestID != "" {
+		req.Header.Add(RequestIDHeader, requestID)
+	}
+	if c.Auth != nil {
+		if err := c.Auth.Authenticate(req); err != nil {
+			return 500, fmt.Errorf("Unable to authenticate against moogsoft: %s", err.Error())
+		}
+	} else {
+		req.Header.Add("Authorization", fmt.Sprintf("Basic %s", token))
+	}
+
+	if c.Limiter != nil {
+		release, err := c.Limiter.Acquire(ctx)
+		if err != nil {
+			return http.StatusServiceUnavailable, fmt.Errorf("%w: %s", ErrRequestCanceled, err.Error())
+		}
+		defer release()
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req)
 	if err != nil {
+		c.delivery.record(500, err)
+		loggerFor(ctx).Error("Unable to reach moogsoft", "error", err.Error())
 		return 500, err
 	}
+	defer res.Body.Close()
+
+	c.delivery.record(res.StatusCode, nil)
+
+	io.Copy(ioutil.Discard, res.Body)
+	loggerFor(ctx).Info("Sent events to moogsoft", "status_code", res.StatusCode, "destination", c.Destination())
 
 	return res.StatusCode, err
 }
 
-func (c *Client) eventFor(alert PrometheusAlert) (MoogsoftEvent, error) {
+// deliveryFailed reports whether a request should be retried later.
+func deliveryFailed(statusCode int, err error) bool {
+	return err != nil || statusCode >= 500 || statusCode == http.StatusTooManyRequests
+}
+
+// signatureLabels holds, for every supported service, the labels joined to
+// build the signature of its events.
+var signatureLabels = map[string][]string{
+	"bosh-deployment":  boshSignatureLabels,
+	"bosh-job":         boshSignatureLabels,
+	"bosh-job-process": boshSignatureLabels,
+	"prometheus":       {"alertname", "bosh_deployment", "job"},
+	"cf":               {"alertname", "environment", "bosh_deployment"},
+	"probe":            {"alertname", "instance"},
+	"heartbeat":        {"alertname", "environment"},
+}
+
+var boshSignatureLabels = []string{"alertname", "environment", "bosh_name", "bosh_job_az", "bosh_deployment", "bosh_job_name", "bosh_job_index"}
+
+// MappingRules returns the number of services whose alerts get mapped to
+// moogsoft events.
+func MappingRules() int {
+	return len(signatureLabels)
+}
+
+// signatureFor returns the signature of the events sent for the alert. It
+// skips the rest of the mapping, like the host lookups, as the reconciler and
+// the stale checker call it for every active alert.
+func (c *Client) signatureFor(alert PrometheusAlert) string {
+	signature, _ := signatureOf(relabel(alert, c.Relabel))
+	return signature
+}
+
+// signatureOf returns the signature of the relabelled alert from the labels of
+// its service, or its description and false when the service is not supported.
+func signatureOf(alert PrometheusAlert) (string, bool) {
+	labels, ok := signatureLabels[alert.Labels["service"]]
+	if !ok {
+		return alert.Annotations["description"], false
+	}
+
+	values := make([]string, len(labels))
+	for i, label := range labels {
+		values[i] = alert.Labels[label]
+	}
+
+	return strings.Join(values, "::"), true
+}
+
+func (c *Client) eventFor(ctx context.Context, alert PrometheusAlert) (MoogsoftEvent, error) {
 	moogsoftEvent := MoogsoftEvent{
 		Type:                 alert.Labels["service"],
-		Description:          alert.Annotations["description"],
 		AonToolUrl:           alert.GeneratorURL,
 		AonXMattersGroupName: c.XMattersGroupName,
 		Manager:              "Prometheus",
@@ -160,32 +542,34 @@ func (c *Client) eventFor(alert PrometheusAlert) (MoogsoftEvent, error) {
 		AonJSONVersion:       "2",
 		Agent:                c.Env,
 		AgentTime:            alert.GetAgentTime(),
+		AonMetricName:        metricName(alertExpression(alert.GeneratorURL)),
+		AonMetricValue:       c.Metrics.valueFor(alert),
 	}
 
 	var err error
 
-	switch moogsoftEvent.Type {
-	case "bosh-deployment", "bosh-job", "bosh-job-process":
-		moogsoftEvent.Signature = fmt.Sprintf("%s::%s::%s::%s::%s::%s::%s", alert.Labels["alertname"], alert.Labels["environment"], alert.Labels["bosh_name"], alert.Labels["bosh_job_az"], alert.Labels["bosh_deployment"], alert.Labels["bosh_job_name"], alert.Labels["bosh_job_index"])
-		moogsoftEvent.SourceId = ""
-		moogsoftEvent.AonIPAddress = alert.Labels["bosh_job_ip"]
-
-	case "prometheus":
-		moogsoftEvent.Signature = fmt.Sprintf("%s::%s::%s", alert.Labels["alertname"], alert.Labels["bosh_deployment"], alert.Labels["job"])
-
-	case "cf":
-		moogsoftEvent.Signature = fmt.Sprintf("%s::%s::%s", alert.Labels["alertname"], alert.Labels["environment"], alert.Labels["bosh_deployment"])
-
-	case "probe":
-		moogsoftEvent.Signature = fmt.Sprintf("%s::%s", alert.Labels["alertname"], alert.Labels["instance"])
+	description, templateErr := c.Description.render(alert)
+	if templateErr != nil {
+		loggerFor(ctx).Warn("Unable to render the description template", "error", templateErr.Error())
+	}
+	moogsoftEvent.Description = description
 
-	default:
+	signature, supported := signatureOf(alert)
+	moogsoftEvent.Signature = signature
+	if !supported {
 		err = errors.New(fmt.Sprintf("Unsopported service: %s", moogsoftEvent.Type))
-		moogsoftEvent.Signature = alert.Annotations["description"]
 		moogsoftEvent.Severity = 1
 	}
 
+	if strings.HasPrefix(moogsoftEvent.Type, "bosh-") {
+		moogsoftEvent.AonIPAddress = alert.Labels["bosh_job_ip"]
+	}
+	c.IP.apply(ctx, &moogsoftEvent, alert)
+
 	moogsoftEvent.ExternalId = moogsoftEvent.Signature
+	moogsoftEvent.CustomInfo = c.customInfo(alert, moogsoftEvent.Signature)
+
+	loggerFor(ctx).Debug("Mapped alert", "signature", moogsoftEvent.Signature, "severity", moogsoftEvent.Severity.String())
 
 	return moogsoftEvent, err
 }
@@ -14,7 +14,7 @@ import (
 func assertEventCommonFields(e MoogsoftEvent) {
 	ExpectWithOffset(1, e).ShouldNot(BeNil())
 	ExpectWithOffset(1, e.AgentLocation).Should(Equal(""))          // Geographic location of prometheus
-	ExpectWithOffset(1, e.AonMetricName).Should(Equal(""))          // disk percent
+	ExpectWithOffset(1, e.AonMetricName).Should(Equal("up"))        // from the generatorURL g0.expr
 	ExpectWithOffset(1, e.AonMetricValue).Should(Equal(""))         // value of disk percent
 	ExpectWithOffset(1, e.AonMonitoredEntityName).Should(Equal("")) // D:/ | linux mount path
 	ExpectWithOffset(1, e.Agent).Should(Equal("dev"))
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a standard 5 field cron expression: minute, hour, day of
+// month, month and day of week. Fields accept *, numbers, ranges (1-5),
+// lists (1,3) and steps (*/15, 0-30/10).
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+	// anyDay and anyWeekday tell whether the day fields were *, as cron
+	// matches either of them when both are restricted.
+	anyDay, anyWeekday bool
+}
+
+var cronBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+func parseCron(expression string) (*cronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Invalid cron expression %q: expected 5 fields", expression)
+	}
+
+	var sets [5]map[int]bool
+	for i, field := range fields {
+		set, err := parseCronField(field, cronBounds[i][0], cronBounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cron expression %q: %s", expression, err.Error())
+		}
+		sets[i] = set
+	}
+
+	// Sunday can also be written 7.
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+
+	return &cronSchedule{
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekdays:   sets[4],
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	set := map[int]bool{}
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value %q", part)
+				}
+			}
+		}
+
+		// The day of week accepts 7 for sunday.
+		limit := max
+		if max == 6 {
+			limit = 7
+		}
+		if from < min || to > limit || from > to {
+			return nil, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+
+		for value := from; value <= to; value += step {
+			set[value] = true
+		}
+	}
+
+	return set, nil
+}
+
+// matchesDay reports whether the schedule fires on the day of t.
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	day, weekday := s.days[t.Day()], s.weekdays[int(t.Weekday())]
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// previous returns the last time the schedule fired at or before t, and false
+// when it did not fire after since. Months, days and hours that do not match
+// are skipped whole.
+func (s *cronSchedule) previous(t time.Time, since time.Time) (time.Time, bool) {
+	t = t.Truncate(time.Minute)
+	for t.After(since) {
+		year, month, day := t.Date()
+		switch {
+		case !s.months[int(month)]:
+			t = time.Date(year, month, 1, 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+		case !s.matchesDay(t):
+			t = time.Date(year, month, day, 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+		case !s.hours[t.Hour()]:
+			t = t.Add(-time.Duration(t.Minute()+1) * time.Minute)
+		default:
+			minute := t.Minute()
+			for minute >= 0 && !s.minutes[minute] {
+				minute--
+			}
+			if minute == t.Minute() {
+				return t, true
+			}
+			// Without a matching minute left this goes to the previous hour.
+			t = t.Add(-time.Duration(t.Minute()-minute) * time.Minute)
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// firedWithin reports whether the schedule fired in the duration up to t.
+func (s *cronSchedule) firedWithin(t time.Time, duration time.Duration) bool {
+	t = t.Truncate(time.Minute)
+	_, fired := s.previous(t, t.Add(-duration))
+
+	return fired
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// CustomInfoConfig selects the prometheus context passed along in the
+// custom_info of the events, for the moogsoft correlation and enrichment
+// rules.
+type CustomInfoConfig struct {
+	// Labels includes every label of the alert.
+	Labels bool `yaml:"labels"`
+	// Annotations are the annotations included, * includes all of them.
+	Annotations []string `yaml:"annotations"`
+	GroupKey    bool     `yaml:"group_key"`
+	ExternalURL bool     `yaml:"external_url"`
+	// SilenceURL includes a link to the alertmanager silence of the alert,
+	// or to create one, or the grafana silence url.
+	SilenceURL bool `yaml:"silence_url"`
+}
+
+// customInfo returns the custom info of the event sent for the alert, nil
+// when there is nothing to include. The grafana organization is always
+// included so alerts of different organizations can be told apart.
+func (c *Client) customInfo(alert PrometheusAlert, signature string) map[string]interface{} {
+	config := c.CustomInfo
+	if config == nil {
+		config = &CustomInfoConfig{}
+	}
+
+	info := map[string]interface{}{}
+
+	if alert.OrgID != 0 {
+		info["grafana_org_id"] = alert.OrgID
+	}
+
+	if config.Labels && len(alert.Labels) > 0 {
+		info["labels"] = alert.Labels
+	}
+
+	annotations := map[string]string{}
+	for _, name := range config.Annotations {
+		if name == "*" {
+			for name, value := range alert.Annotations {
+				annotations[name] = value
+			}
+		} else if value, ok := alert.Annotations[name]; ok {
+			annotations[name] = value
+		}
+	}
+	if len(annotations) > 0 {
+		info["annotations"] = annotations
+	}
+
+	if config.GroupKey && alert.GroupKey != "" {
+		info["group_key"] = alert.GroupKey
+	}
+
+	if config.ExternalURL && alert.ExternalURL != "" {
+		info["external_url"] = alert.ExternalURL
+	}
+
+	if config.SilenceURL {
+		if silenceURL := c.silenceURL(alert, signature); silenceURL != "" {
+			info["silence_url"] = silenceURL
+		}
+	}
+
+	if len(info) == 0 {
+		return nil
+	}
+
+	return info
+}
+
+// silenceURL returns the grafana silence url, or the alertmanager page of the
+// silence created from moogsoft, or the one creating a silence of the alert.
+func (c *Client) silenceURL(alert PrometheusAlert, signature string) string {
+	if alert.SilenceURL != "" {
+		return alert.SilenceURL
+	}
+
+	if alert.ExternalURL == "" {
+		return ""
+	}
+	externalURL := strings.TrimSuffix(alert.ExternalURL, "/")
+
+	if c.Registry != nil {
+		if record, ok := c.Registry.Get(signature); ok && record.SilenceID != "" {
+			return fmt.Sprintf("%s/#/silences/%s", externalURL, url.PathEscape(record.SilenceID))
+		}
+	}
+
+	labels := alert.Labels
+	if alert.receivedLabels != nil {
+		labels = alert.receivedLabels
+	}
+
+	matchers := make([]string, 0, len(labels))
+	for name, value := range labels {
+		matchers = append(matchers, fmt.Sprintf("%s=%q", name, value))
+	}
+	sort.Strings(matchers)
+
+	return fmt.Sprintf("%s/#/silences/new?filter=%s", externalURL, url.QueryEscape("{"+strings.Join(matchers, ",")+"}"))
+}
+
+// withGroup sets the group key and external url of the webhook payload on its
+// alerts.
+func withGroup(alerts []PrometheusAlert, groupKey string, externalURL string) []PrometheusAlert {
+	for i := range alerts {
+		if alerts[i].GroupKey == "" {
+			alerts[i].GroupKey = groupKey
+		}
+		if alerts[i].ExternalURL == "" {
+			alerts[i].ExternalURL = externalURL
+		}
+	}
+
+	return alerts
+}
@@ -0,0 +1,77 @@
+package client_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("CustomInfoConfig", func() {
+	var client *Client
+	var moogsoftServer FakeMoogsoftServer
+
+	payload := `{
+    "groupKey": "{}:{alertname=\"ProbeUnsuccesful\"}",
+    "externalURL": "https://alertmanager.your-domain.com/",
+    "alerts": [{
+      "status": "firing",
+      "labels": { "alertname": "ProbeUnsuccesful", "instance": "someuri.com:8080", "service": "probe", "severity": "warning" },
+      "annotations": { "description": "probe failing", "runbook_url": "https://runbooks/probe", "summary": "probe down" },
+      "startsAt": "2018-10-23T16:44:39.901211833Z"
+    }]
+  }`
+
+	send := func() MoogsoftEvent {
+		_, err := client.SendEventsContext(context.Background(), payload, moogsoftServer.GetToken())
+		Expect(err).ShouldNot(HaveOccurred())
+		return moogsoftServer.ReceivedEvents[len(moogsoftServer.ReceivedEvents)-1]
+	}
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+
+		client = &Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+			Registry:       NewRegistry(),
+		}
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+	})
+
+	It("Should not send custom info by default", func() {
+		Expect(send().CustomInfo).Should(BeNil())
+	})
+
+	It("Should send the selected alert context", func() {
+		client.CustomInfo = &CustomInfoConfig{Labels: true, Annotations: []string{"runbook_url", "missing"}, GroupKey: true, ExternalURL: true, SilenceURL: true}
+
+		info := send().CustomInfo
+
+		Expect(info).Should(HaveKeyWithValue("labels", HaveKeyWithValue("instance", "someuri.com:8080")))
+		Expect(info).Should(HaveKeyWithValue("annotations", Equal(map[string]interface{}{"runbook_url": "https://runbooks/probe"})))
+		Expect(info).Should(HaveKeyWithValue("group_key", `{}:{alertname="ProbeUnsuccesful"}`))
+		Expect(info).Should(HaveKeyWithValue("external_url", "https://alertmanager.your-domain.com/"))
+		Expect(info).Should(HaveKeyWithValue("silence_url",
+			"https://alertmanager.your-domain.com/#/silences/new?filter=%7Balertname%3D%22ProbeUnsuccesful%22%2Cinstance%3D%22someuri.com%3A8080%22%2Cservice%3D%22probe%22%2Cseverity%3D%22warning%22%7D"))
+	})
+
+	It("Should include every annotation with *", func() {
+		client.CustomInfo = &CustomInfoConfig{Annotations: []string{"*"}}
+
+		Expect(send().CustomInfo).Should(HaveKeyWithValue("annotations", HaveLen(3)))
+	})
+
+	It("Should link the silence created from moogsoft", func() {
+		client.CustomInfo = &CustomInfoConfig{SilenceURL: true}
+		send()
+		Expect(client.Registry.SetSilence("ProbeUnsuccesful::someuri.com:8080", "abc-123")).Should(Succeed())
+
+		Expect(send().CustomInfo).Should(HaveKeyWithValue("silence_url", "https://alertmanager.your-domain.com/#/silences/abc-123"))
+	})
+})
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"unicode/utf8"
+)
+
+// DescriptionConfig builds the description of the events from a
+// text/template, e.g.
+//
+//	{{ .Description }} - runbook: {{ .Annotations.runbook_url }}
+type DescriptionConfig struct {
+	Template string `yaml:"template"`
+	// MaxLength truncates longer descriptions, so moogsoft does not reject
+	// them. Zero does not truncate.
+	MaxLength int `yaml:"max_length"`
+
+	tmpl *template.Template
+}
+
+// descriptionData is what description templates have access to.
+type descriptionData struct {
+	PrometheusAlert
+	// Description is the first of the description, summary or message
+	// annotations set, or the alertname.
+	Description string
+	Severity    string
+}
+
+// Validate parses the template.
+func (c *DescriptionConfig) Validate() error {
+	if c.MaxLength < 0 {
+		return fmt.Errorf("Invalid description max_length: %d", c.MaxLength)
+	}
+
+	if c.Template == "" {
+		return nil
+	}
+
+	var err error
+	if c.tmpl, err = template.New("description").Option("missingkey=zero").Parse(c.Template); err != nil {
+		return fmt.Errorf("Invalid description template: %s", err.Error())
+	}
+
+	return nil
+}
+
+// render returns the description of the event sent for the alert, falling
+// back to the default description when the template fails.
+func (c *DescriptionConfig) render(alert PrometheusAlert) (string, error) {
+	description := defaultDescription(alert)
+
+	if c == nil {
+		return description, nil
+	}
+
+	var err error
+	if c.tmpl != nil {
+		var rendered bytes.Buffer
+		data := descriptionData{PrometheusAlert: alert, Description: description, Severity: alert.GetSeverity().String()}
+
+		if err = c.tmpl.Execute(&rendered, data); err == nil {
+			description = rendered.String()
+		}
+	}
+
+	return truncate(description, c.MaxLength), err
+}
+
+func defaultDescription(alert PrometheusAlert) string {
+	for _, annotation := range []string{"description", "summary", "message"} {
+		if description := alert.Annotations[annotation]; description != "" {
+			return description
+		}
+	}
+
+	return alert.Labels["alertname"]
+}
+
+// truncate cuts s to maxLength characters, ending it with ... when cut.
+func truncate(s string, maxLength int) string {
+	if maxLength <= 0 || utf8.RuneCountInString(s) <= maxLength {
+		return s
+	}
+
+	if maxLength <= 3 {
+		return string([]rune(s)[:maxLength])
+	}
+
+	return string([]rune(s)[:maxLength-3]) + "..."
+}
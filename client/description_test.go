@@ -0,0 +1,86 @@
+package client_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("DescriptionConfig", func() {
+	var client *Client
+	var moogsoftServer FakeMoogsoftServer
+
+	alert := func(annotations map[string]string) PrometheusAlert {
+		return PrometheusAlert{
+			Status:       "firing",
+			Labels:       map[string]string{"alertname": "ProbeUnsuccesful", "instance": "someuri.com:8080", "service": "probe", "severity": "critical"},
+			Annotations:  annotations,
+			StartsAt:     "2018-10-23T16:44:39.901211833Z",
+			GeneratorURL: "https://prometheus.your-domain.com/graph",
+		}
+	}
+
+	send := func(alert PrometheusAlert) string {
+		_, err := client.SendAlerts(context.Background(), []PrometheusAlert{alert}, moogsoftServer.GetToken())
+		Expect(err).ShouldNot(HaveOccurred())
+		return moogsoftServer.ReceivedEvents[len(moogsoftServer.ReceivedEvents)-1].Description
+	}
+
+	configure := func(config DescriptionConfig) {
+		Expect(config.Validate()).Should(Succeed())
+		client.Description = &config
+	}
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+
+		client = &Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+		}
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+	})
+
+	Context("without template", func() {
+		It("Should use the description annotation", func() {
+			Expect(send(alert(map[string]string{"description": "probe failing", "summary": "probe down"}))).Should(Equal("probe failing"))
+		})
+
+		It("Should fall back to the summary, the message and the alertname", func() {
+			Expect(send(alert(map[string]string{"summary": "probe down", "message": "failing"}))).Should(Equal("probe down"))
+			Expect(send(alert(map[string]string{"message": "failing"}))).Should(Equal("failing"))
+			Expect(send(alert(nil))).Should(Equal("ProbeUnsuccesful"))
+		})
+	})
+
+	It("Should render the template", func() {
+		configure(DescriptionConfig{
+			Template: `[{{ .Severity }}] {{ .Description }} on {{ .Labels.instance }}{{ if .Annotations.runbook_url }} - runbook: {{ .Annotations.runbook_url }}{{ end }} - {{ .GeneratorURL }}`,
+		})
+
+		Expect(send(alert(map[string]string{"summary": "probe down", "runbook_url": "https://runbooks/probe"}))).Should(
+			Equal("[CRITICAL] probe down on someuri.com:8080 - runbook: https://runbooks/probe - https://prometheus.your-domain.com/graph"))
+	})
+
+	It("Should truncate long descriptions", func() {
+		configure(DescriptionConfig{MaxLength: 10})
+
+		Expect(send(alert(map[string]string{"description": "probe failing for the last 15m"}))).Should(Equal("probe f..."))
+	})
+
+	It("Should fall back to the default description when the template fails", func() {
+		configure(DescriptionConfig{Template: `{{ .Labels.instance.missing }}`})
+
+		Expect(send(alert(map[string]string{"description": "probe failing"}))).Should(Equal("probe failing"))
+	})
+
+	It("Should reject invalid templates", func() {
+		Expect((&DescriptionConfig{Template: "{{ .Description"}).Validate()).ShouldNot(Succeed())
+	})
+})
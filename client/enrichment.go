@@ -0,0 +1,208 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// HTTPEnrichment enriches the moogsoft events with the response of an HTTP
+// service, e.g. a CMDB REST API, queried with the values of the Labels of the
+// alert. Responses are cached for CacheTTL, and events are sent unenriched
+// when the service fails or does not answer within Timeout. After a failure
+// the service is skipped for FailureBackoff, so an outage does not delay every
+// event by the timeout.
+type HTTPEnrichment struct {
+	Name string `yaml:"name"`
+	// URL is called with a GET request with the Labels as query parameters.
+	URL    string   `yaml:"url"`
+	Labels []string `yaml:"labels"`
+	// Fields maps the json name of the event fields to the JSONPath of their
+	// value in the response.
+	Fields map[string]string `yaml:"fields"`
+	// Override replaces the event fields already set, by default only the
+	// empty ones are filled.
+	Override       bool          `yaml:"override"`
+	Timeout        time.Duration `yaml:"timeout"`
+	CacheTTL       time.Duration `yaml:"cache_ttl"`
+	FailureBackoff time.Duration `yaml:"failure_backoff"`
+
+	// HTTPClient calls the service, defaults to http.DefaultClient.
+	HTTPClient *http.Client `yaml:"-"`
+
+	mu      sync.Mutex
+	cache   map[string]enrichmentCacheEntry
+	breaker *CircuitBreaker
+}
+
+type enrichmentCacheEntry struct {
+	fields  map[string]string
+	expires time.Time
+}
+
+// Validate checks the url, the fields and their paths.
+func (e *HTTPEnrichment) Validate() error {
+	if e.Name == "" {
+		return fmt.Errorf("HTTP enrichment without name")
+	}
+
+	if _, err := url.ParseRequestURI(e.URL); err != nil {
+		return fmt.Errorf("HTTP enrichment %s: %s", e.Name, err.Error())
+	}
+
+	for field, path := range e.Fields {
+		if _, err := parseJSONPath(path); err != nil {
+			return fmt.Errorf("HTTP enrichment %s: %s", e.Name, err.Error())
+		}
+		if err := setEventField(&MoogsoftEvent{}, field, "", true); err != nil {
+			return fmt.Errorf("HTTP enrichment %s: %s", e.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// enrich sets the fields of the service response on the event. On error the
+// event is left unchanged.
+func (e *HTTPEnrichment) enrich(ctx context.Context, event *MoogsoftEvent, alert PrometheusAlert) error {
+	query := url.Values{}
+	for _, label := range e.Labels {
+		query.Set(label, alert.Labels[label])
+	}
+	key := query.Encode()
+
+	fields, ok := e.cached(key)
+	if !ok {
+		breaker := e.circuitBreaker()
+		if !breaker.Allow() {
+			return fmt.Errorf("HTTP enrichment %s skipped after a failure", e.Name)
+		}
+
+		var err error
+		if fields, err = e.fetch(ctx, key); err != nil {
+			breaker.Failure()
+			return err
+		}
+		breaker.Success()
+		e.store(key, fields)
+	}
+
+	setEventFields(event, fields, e.Override)
+
+	return nil
+}
+
+// circuitBreaker returns the breaker skipping the service for FailureBackoff
+// after a failure, 30s by default.
+func (e *HTTPEnrichment) circuitBreaker() *CircuitBreaker {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.breaker == nil {
+		backoff := e.FailureBackoff
+		if backoff <= 0 {
+			backoff = 30 * time.Second
+		}
+		e.breaker = NewCircuitBreaker(1, backoff)
+	}
+
+	return e.breaker
+}
+
+func (e *HTTPEnrichment) cached(key string) (map[string]string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	entry, ok := e.cache[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+
+	return entry.fields, true
+}
+
+func (e *HTTPEnrichment) store(key string, fields map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ttl := e.CacheTTL
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+
+	if e.cache == nil {
+		e.cache = map[string]enrichmentCacheEntry{}
+	}
+
+	now := time.Now()
+	for k, entry := range e.cache {
+		if now.After(entry.expires) {
+			delete(e.cache, k)
+		}
+	}
+
+	e.cache[key] = enrichmentCacheEntry{fields: fields, expires: now.Add(ttl)}
+}
+
+// fetch calls the service. Not found responses are cached as no fields.
+func (e *HTTPEnrichment) fetch(ctx context.Context, query string) (map[string]string, error) {
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	separator := "?"
+	if u, _ := url.Parse(e.URL); u != nil && u.RawQuery != "" {
+		separator = "&"
+	}
+
+	req, err := http.NewRequest("GET", e.URL+separator+query, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	httpClient := e.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	if res.StatusCode == http.StatusNotFound {
+		return map[string]string{}, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP enrichment %s responded with status code %d", e.Name, res.StatusCode)
+	}
+
+	var document interface{}
+	if err := json.NewDecoder(res.Body).Decode(&document); err != nil {
+		return nil, fmt.Errorf("Invalid HTTP enrichment %s response: %s", e.Name, err.Error())
+	}
+
+	fields := map[string]string{}
+	for field, path := range e.Fields {
+		matches, _ := jsonPath(document, path)
+		if len(matches) > 0 && stringify(matches[0]) != "" {
+			fields[field] = stringify(matches[0])
+		}
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,149 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("HTTPEnrichment", func() {
+	var client *Client
+	var moogsoftServer FakeMoogsoftServer
+	var cmdb *httptest.Server
+	var requests int32
+	// delay is read by the handler goroutine, so it is only accessed atomically.
+	var delay int64
+	var enrichment *HTTPEnrichment
+
+	alert := func(deployment string) PrometheusAlert {
+		return PrometheusAlert{
+			Status:   "firing",
+			Labels:   map[string]string{"alertname": "Down", "environment": "prod", "bosh_deployment": deployment, "service": "cf", "severity": "warning"},
+			StartsAt: "2018-10-23T16:44:39.901211833Z",
+		}
+	}
+
+	send := func(alerts ...PrometheusAlert) {
+		_, err := client.SendAlerts(context.Background(), alerts, moogsoftServer.GetToken())
+		Expect(err).ShouldNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		atomic.StoreInt32(&requests, 0)
+		atomic.StoreInt64(&delay, 0)
+
+		cmdb = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			time.Sleep(time.Duration(atomic.LoadInt64(&delay)))
+
+			if r.URL.Query().Get("bosh_deployment") != "cf" || r.URL.Query().Get("environment") != "prod" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			fmt.Fprint(w, `{"owner": {"team": "PCF-Ops", "oncall": "PCF-Oncall"}, "site": "Frankfurt"}`)
+		}))
+
+		moogsoftServer.Start()
+
+		enrichment = &HTTPEnrichment{
+			Name:   "cmdb",
+			URL:    cmdb.URL + "/ci",
+			Labels: []string{"environment", "bosh_deployment"},
+			Fields: map[string]string{
+				"aonSNOWGroupName":     "$.owner.team",
+				"aonXMattersGroupName": "$.owner.oncall",
+				"agent_location":       "$.site",
+			},
+			Timeout: 100 * time.Millisecond,
+		}
+		Expect(enrichment.Validate()).Should(Succeed())
+
+		client = &Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+			Enrichments:    []*HTTPEnrichment{enrichment},
+		}
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+		cmdb.Close()
+	})
+
+	It("Should set the event fields from the response", func() {
+		send(alert("cf"))
+
+		event := moogsoftServer.ReceivedEvents[0]
+		Expect(event.AonSNOWGroupName).Should(Equal("PCF-Ops"))
+		Expect(event.AonXMattersGroupName).Should(Equal("PCF-Oncall"))
+		Expect(event.AgentLocation).Should(Equal("Frankfurt"))
+	})
+
+	It("Should cache the responses", func() {
+		send(alert("cf"), alert("cf"), alert("redis"), alert("redis"))
+
+		Expect(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(2))
+		Expect(moogsoftServer.ReceivedEvents[1].AonSNOWGroupName).Should(Equal("PCF-Ops"))
+		Expect(moogsoftServer.ReceivedEvents[3].AonSNOWGroupName).Should(BeEmpty())
+	})
+
+	It("Should call the service again once the cache expired", func() {
+		enrichment.CacheTTL = time.Millisecond
+
+		send(alert("cf"))
+		time.Sleep(5 * time.Millisecond)
+		send(alert("cf"))
+
+		Expect(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(2))
+	})
+
+	It("Should send the event unenriched when the service times out", func() {
+		atomic.StoreInt64(&delay, int64(300*time.Millisecond))
+
+		send(alert("cf"))
+
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+		Expect(moogsoftServer.ReceivedEvents[0].AonSNOWGroupName).Should(BeEmpty())
+	})
+
+	It("Should skip the service for a while after a failure", func() {
+		atomic.StoreInt64(&delay, int64(300*time.Millisecond))
+		send(alert("cf"))
+
+		atomic.StoreInt64(&delay, 0)
+		start := time.Now()
+		send(alert("cf"), alert("redis"))
+
+		Expect(time.Since(start)).Should(BeNumerically("<", 100*time.Millisecond))
+		Expect(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(1))
+		Expect(moogsoftServer.ReceivedEvents[1].AonSNOWGroupName).Should(BeEmpty())
+	})
+
+	It("Should not cache failures once the backoff passed", func() {
+		enrichment.FailureBackoff = 10 * time.Millisecond
+
+		atomic.StoreInt64(&delay, int64(300*time.Millisecond))
+		send(alert("cf"))
+
+		atomic.StoreInt64(&delay, 0)
+		time.Sleep(20 * time.Millisecond)
+		send(alert("cf"))
+
+		Expect(moogsoftServer.ReceivedEvents[1].AonSNOWGroupName).Should(Equal("PCF-Ops"))
+	})
+
+	It("Should reject invalid enrichments", func() {
+		Expect((&HTTPEnrichment{Name: "cmdb", URL: "not a url"}).Validate()).ShouldNot(Succeed())
+		Expect((&HTTPEnrichment{Name: "cmdb", URL: cmdb.URL, Fields: map[string]string{"owner": "$.owner"}}).Validate()).ShouldNot(Succeed())
+		Expect((&HTTPEnrichment{Name: "cmdb", URL: cmdb.URL, Fields: map[string]string{"agent_location": "site"}}).Validate()).ShouldNot(Succeed())
+	})
+})
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FakeAlertmanagerServer serves the alertmanager /api/v2/alerts endpoint
+// with the alerts set in Alerts, filtered by the receiver parameter, and keeps the silences created and not yet
+// expired in Silences.
+type FakeAlertmanagerServer struct {
+	engine   *gin.Engine
+	server   *httptest.Server
+	Alerts   []AlertmanagerAlert
+	Silences map[string]AlertmanagerSilence
+
+	mu sync.Mutex
+}
+
+func (fas *FakeAlertmanagerServer) Start() {
+	fas.engine = gin.New()
+	fas.server = httptest.NewServer(fas.engine)
+	fas.Alerts = []AlertmanagerAlert{}
+	fas.Silences = map[string]AlertmanagerSilence{}
+
+	fas.engine.GET("/api/v2/alerts", func(c *gin.Context) {
+		receiver, err := regexp.Compile("^(?:" + c.Query("receiver") + ")$")
+		if err != nil || c.Query("receiver") == "" {
+			c.JSON(http.StatusOK, fas.Alerts)
+			return
+		}
+
+		alerts := []AlertmanagerAlert{}
+		for _, alert := range fas.Alerts {
+			for _, r := range alert.Receivers {
+				if receiver.MatchString(r.Name) {
+					alerts = append(alerts, alert)
+					break
+				}
+			}
+		}
+		c.JSON(http.StatusOK, alerts)
+	})
+
+	fas.engine.POST("/api/v2/silences", func(c *gin.Context) {
+		var silence AlertmanagerSilence
+		if err := c.BindJSON(&silence); err != nil {
+			return
+		}
+
+		fas.mu.Lock()
+		defer fas.mu.Unlock()
+
+		silence.ID = fmt.Sprintf("silence-%d", len(fas.Silences)+1)
+		fas.Silences[silence.ID] = silence
+		c.JSON(http.StatusOK, gin.H{"silenceID": silence.ID})
+	})
+
+	fas.engine.DELETE("/api/v2/silence/:id", func(c *gin.Context) {
+		fas.mu.Lock()
+		defer fas.mu.Unlock()
+
+		if _, ok := fas.Silences[c.Param("id")]; !ok {
+			c.Status(http.StatusNotFound)
+			return
+		}
+
+		delete(fas.Silences, c.Param("id"))
+		c.Status(http.StatusOK)
+	})
+}
+
+// SilenceCount returns the number of silences not yet expired, for the
+// silences expired in the background.
+func (fas *FakeAlertmanagerServer) SilenceCount() int {
+	fas.mu.Lock()
+	defer fas.mu.Unlock()
+
+	return len(fas.Silences)
+}
+
+func (fas *FakeAlertmanagerServer) Stop() {
+	fas.server.Close()
+}
+
+func (fas *FakeAlertmanagerServer) URL() string {
+	return fas.server.URL
+}
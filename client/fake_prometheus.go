@@ -0,0 +1,51 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FakePrometheusServer serves the prometheus /api/v1/rules endpoint with
+// the alerting rules set in Rules, and the /api/v1/query endpoint with the
+// Samples, keeping the received queries in ReceivedQueries.
+type FakePrometheusServer struct {
+	engine          *gin.Engine
+	server          *httptest.Server
+	Rules           []PrometheusRule
+	Samples         []PrometheusSample
+	ReceivedQueries []url.Values
+}
+
+func (fps *FakePrometheusServer) Start() {
+	fps.engine = gin.New()
+	fps.server = httptest.NewServer(fps.engine)
+	fps.Rules = []PrometheusRule{}
+	fps.Samples = []PrometheusSample{}
+	fps.ReceivedQueries = []url.Values{}
+
+	fps.engine.GET("/api/v1/rules", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   gin.H{"groups": []gin.H{{"name": "fake", "rules": fps.Rules}}},
+		})
+	})
+
+	fps.engine.GET("/api/v1/query", func(c *gin.Context) {
+		fps.ReceivedQueries = append(fps.ReceivedQueries, c.Request.URL.Query())
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   gin.H{"resultType": "vector", "result": fps.Samples},
+		})
+	})
+}
+
+func (fps *FakePrometheusServer) Stop() {
+	fps.server.Close()
+}
+
+func (fps *FakePrometheusServer) URL() string {
+	return fps.server.URL
+}
@@ -16,6 +16,11 @@ type FakeMoogsoftServer struct {
 	server         *httptest.Server
 	token          string
 	ReceivedEvents []MoogsoftEvent
+	// ReceivedRequestIDs holds the X-Request-ID header of every request.
+	ReceivedRequestIDs []string
+	// FailWith makes the server answer every request with the given status
+	// code when set.
+	FailWith int
 }
 
 func (fms *FakeMoogsoftServer) Start() {
@@ -26,9 +31,15 @@ func (fms *FakeMoogsoftServer) Start() {
 
 	fms.token = fmt.Sprintf("%d", rand.Intn(9999))
 	fms.ReceivedEvents = []MoogsoftEvent{}
+	fms.ReceivedRequestIDs = []string{}
+	fms.FailWith = 0
 
 	fms.engine.POST(fms.GetEventsEndpoint(), func(c *gin.Context) {
-		if c.GetHeader("Authorization") == fmt.Sprintf("Basic %s", fms.token) {
+		fms.ReceivedRequestIDs = append(fms.ReceivedRequestIDs, c.GetHeader(RequestIDHeader))
+
+		if fms.FailWith != 0 {
+			c.String(fms.FailWith, "Moogsoft is failing")
+		} else if c.GetHeader("Authorization") == fmt.Sprintf("Basic %s", fms.token) {
 			rawBody, _ := c.GetRawData()
 
 			var moogsoftPayload MoogsoftPayload
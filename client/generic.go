@@ -0,0 +1,307 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// GenericInput extracts alerts from the JSON body sent by tools that do not
+// speak the alertmanager webhook format.
+//
+// Every field but Alerts is an expression evaluated against each alert: a
+// JSONPath starting with $, a text/template when it contains {{, or a
+// constant otherwise.
+type GenericInput struct {
+	Name string `yaml:"name"`
+	// Alerts is the JSONPath of the alerts in the body, defaults to $ which
+	// handles both a single alert and an array of alerts.
+	Alerts string `yaml:"alerts"`
+	Status string `yaml:"status"`
+	// StatusMap translates the tool status values to firing or resolved.
+	StatusMap    map[string]string `yaml:"status_map"`
+	Labels       map[string]string `yaml:"labels"`
+	Annotations  map[string]string `yaml:"annotations"`
+	StartsAt     string            `yaml:"starts_at"`
+	GeneratorURL string            `yaml:"generator_url"`
+
+	// TimestampUnit is the unit of numeric starts_at values, s or ms. By
+	// default values too large to be seconds are read as milliseconds.
+	TimestampUnit string `yaml:"timestamp_unit"`
+
+	templates map[string]*template.Template
+}
+
+// ValidateGenericInputs validates every input and checks their names are
+// unique.
+func ValidateGenericInputs(inputs []GenericInput) error {
+	names := map[string]bool{}
+
+	for i := range inputs {
+		if err := inputs[i].Validate(); err != nil {
+			return err
+		}
+
+		if names[inputs[i].Name] {
+			return fmt.Errorf("Duplicate generic input: %s", inputs[i].Name)
+		}
+		names[inputs[i].Name] = true
+	}
+
+	return nil
+}
+
+// Validate checks that every expression of the input can be evaluated and
+// parses its templates.
+func (i *GenericInput) Validate() error {
+	if i.Name == "" {
+		return errors.New("Generic input without name")
+	}
+
+	switch i.TimestampUnit {
+	case "", "s", "ms":
+	default:
+		return fmt.Errorf("Generic input %s: invalid timestamp_unit %s", i.Name, i.TimestampUnit)
+	}
+
+	expressions := []string{i.alertsPath(), i.Status, i.StartsAt, i.GeneratorURL}
+	for _, expression := range i.Labels {
+		expressions = append(expressions, expression)
+	}
+	for _, expression := range i.Annotations {
+		expressions = append(expressions, expression)
+	}
+
+	i.templates = map[string]*template.Template{}
+	for _, expression := range expressions {
+		if err := i.parse(expression); err != nil {
+			return fmt.Errorf("Generic input %s: %s", i.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// parse checks the syntax of the expression, keeping the parsed templates.
+func (i *GenericInput) parse(expression string) error {
+	switch {
+	case strings.HasPrefix(expression, "$"):
+		_, err := parseJSONPath(expression)
+		return err
+
+	case strings.Contains(expression, "{{"):
+		tmpl, err := template.New("expression").Option("missingkey=zero").Funcs(template.FuncMap{"orEmpty": orEmpty}).Parse(expression)
+		if err != nil {
+			return err
+		}
+		emptyWhenMissing(tmpl.Tree.Root, tmpl.Tree)
+		i.templates[expression] = tmpl
+	}
+
+	return nil
+}
+
+// Decode extracts the alerts from the body.
+func (i GenericInput) Decode(body []byte) ([]PrometheusAlert, error) {
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+
+	matches, err := jsonPath(document, i.alertsPath())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(matches) == 1 {
+		if items, ok := matches[0].([]interface{}); ok {
+			matches = items
+		}
+	}
+
+	alerts := make([]PrometheusAlert, 0, len(matches))
+	for _, match := range matches {
+		alert, err := i.alertFor(match)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, nil
+}
+
+func (i GenericInput) alertsPath() string {
+	if i.Alerts == "" {
+		return "$"
+	}
+
+	return i.Alerts
+}
+
+func (i GenericInput) alertFor(document interface{}) (PrometheusAlert, error) {
+	var err error
+	alert := PrometheusAlert{
+		Labels:      map[string]string{},
+		Annotations: map[string]string{},
+	}
+
+	if alert.Status, err = i.evaluate(i.Status, document); err != nil {
+		return alert, err
+	}
+	if status, ok := i.StatusMap[alert.Status]; ok {
+		alert.Status = status
+	}
+	if alert.Status == "" {
+		alert.Status = "firing"
+	}
+
+	for name, expression := range i.Labels {
+		if alert.Labels[name], err = i.evaluate(expression, document); err != nil {
+			return alert, err
+		}
+	}
+
+	for name, expression := range i.Annotations {
+		if alert.Annotations[name], err = i.evaluate(expression, document); err != nil {
+			return alert, err
+		}
+	}
+
+	if alert.StartsAt, err = i.evaluate(i.StartsAt, document); err != nil {
+		return alert, err
+	}
+	alert.StartsAt = normalizeTime(alert.StartsAt, i.TimestampUnit)
+
+	if alert.GeneratorURL, err = i.evaluate(i.GeneratorURL, document); err != nil {
+		return alert, err
+	}
+
+	return alert, nil
+}
+
+// SendGenericEvents sends the alerts extracted by input from the payload to
+// moogsoft.
+func (c *Client) SendGenericEvents(ctx context.Context, input GenericInput, payload string, token string) (int, error) {
+	alerts, err := input.Decode([]byte(payload))
+	if err != nil {
+		loggerFor(ctx).Error("Invalid generic payload", "input", input.Name, "error", err.Error(), "payload_size", len(payload))
+		return 500, err
+	}
+
+	return c.SendAlerts(ctx, alerts, token)
+}
+
+// evaluate returns the value of the expression for the document.
+func (i GenericInput) evaluate(expression string, document interface{}) (string, error) {
+	switch {
+	case strings.HasPrefix(expression, "$"):
+		matches, err := jsonPath(document, expression)
+		if err != nil || len(matches) == 0 {
+			return "", err
+		}
+		return stringify(matches[0]), nil
+
+	case strings.Contains(expression, "{{"):
+		tmpl, ok := i.templates[expression]
+		if !ok {
+			return "", fmt.Errorf("Generic input %s was not validated", i.Name)
+		}
+
+		var value bytes.Buffer
+		if err := tmpl.Execute(&value, document); err != nil {
+			return "", err
+		}
+		return value.String(), nil
+
+	default:
+		return expression, nil
+	}
+}
+
+// emptyWhenMissing pipes every value printed by the template to orEmpty.
+// missingkey=zero leaves a nil interface for the fields missing from a JSON
+// object, which text/template prints as <no value>.
+func emptyWhenMissing(node parse.Node, tree *parse.Tree) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			emptyWhenMissing(child, tree)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) == 0 {
+			orEmpty := parse.NewIdentifier("orEmpty").SetTree(tree).SetPos(n.Pos)
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{orEmpty}})
+		}
+	case *parse.IfNode:
+		emptyWhenMissing(n.List, tree)
+		emptyWhenMissing(n.ElseList, tree)
+	case *parse.RangeNode:
+		emptyWhenMissing(n.List, tree)
+		emptyWhenMissing(n.ElseList, tree)
+	case *parse.WithNode:
+		emptyWhenMissing(n.List, tree)
+		emptyWhenMissing(n.ElseList, tree)
+	}
+}
+
+func orEmpty(value interface{}) interface{} {
+	if value == nil {
+		return ""
+	}
+
+	return value
+}
+
+func stringify(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+// millisecondsThreshold is the smallest unix timestamp read as milliseconds
+// when the unit is not set, in seconds it is more than a thousand years away.
+const millisecondsThreshold = 1e11
+
+// normalizeTime converts unix timestamps in unit to RFC3339, defaulting to
+// now when the time is missing.
+func normalizeTime(value string, unit string) string {
+	if value == "" {
+		return time.Now().UTC().Format(time.RFC3339Nano)
+	}
+
+	timestamp, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+
+	whole, fraction := math.Modf(timestamp)
+	t := time.Unix(int64(whole), int64(fraction*float64(time.Second)))
+	if unit == "ms" || (unit == "" && timestamp >= millisecondsThreshold) {
+		millis := int64(whole)
+		t = time.Unix(millis/1000, millis%1000*int64(time.Millisecond)+int64(fraction*float64(time.Millisecond)))
+	}
+
+	return t.UTC().Format(time.RFC3339Nano)
+}
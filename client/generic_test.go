@@ -0,0 +1,180 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("GenericInput", func() {
+	var input GenericInput
+
+	BeforeEach(func() {
+		input = GenericInput{
+			Name:      "checker",
+			Alerts:    "$.results[*]",
+			Status:    "$.state",
+			StatusMap: map[string]string{"OK": "resolved", "CRITICAL": "firing"},
+			Labels: map[string]string{
+				"alertname": "$.check.name",
+				"instance":  "{{ .host }}:{{ .port }}",
+				"service":   "probe",
+				"severity":  "$['check']['tags'][0]",
+			},
+			Annotations: map[string]string{
+				"description": "$.output",
+			},
+			StartsAt:     "$.timestamp",
+			GeneratorURL: "$.links.self",
+		}
+	})
+
+	Context("#Decode", func() {
+		BeforeEach(func() {
+			Expect(input.Validate()).Should(Succeed())
+		})
+
+		It("Should extract the alerts from the body", func() {
+			alerts, err := input.Decode([]byte(`{
+        "results": [
+          {
+            "state": "CRITICAL",
+            "host": "someuri.com",
+            "port": 8080,
+            "check": { "name": "HttpCheck", "tags": ["critical", "web"] },
+            "output": "connection refused",
+            "timestamp": 1540313079,
+            "links": { "self": "https://checker.your-domain.com/checks/1" }
+          },
+          {
+            "state": "OK",
+            "host": "other.com",
+            "port": 443,
+            "check": { "name": "HttpCheck", "tags": ["warning"] },
+            "timestamp": "2018-10-24T16:44:39Z"
+          }
+        ]
+      }`))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(alerts).Should(HaveLen(2))
+
+			Expect(alerts[0].Status).Should(Equal("firing"))
+			Expect(alerts[0].Labels).Should(Equal(map[string]string{
+				"alertname": "HttpCheck",
+				"instance":  "someuri.com:8080",
+				"service":   "probe",
+				"severity":  "critical",
+			}))
+			Expect(alerts[0].Annotations["description"]).Should(Equal("connection refused"))
+			Expect(alerts[0].StartsAt).Should(Equal("2018-10-23T16:44:39Z"))
+			Expect(alerts[0].GeneratorURL).Should(Equal("https://checker.your-domain.com/checks/1"))
+
+			Expect(alerts[1].Status).Should(Equal("resolved"))
+			Expect(alerts[1].Labels["instance"]).Should(Equal("other.com:443"))
+			Expect(alerts[1].Annotations["description"]).Should(Equal(""))
+			Expect(alerts[1].StartsAt).Should(Equal("2018-10-24T16:44:39Z"))
+		})
+
+		It("Should leave the template fields missing from the alert empty", func() {
+			input.Labels["instance"] = "{{ .host }}{{ if .port }}:{{ .port }}{{ end }}"
+			Expect(input.Validate()).Should(Succeed())
+
+			alerts, err := input.Decode([]byte(`{ "results": [ { "port": 8080 }, { "host": "<no value>" } ] }`))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(alerts[0].Labels["instance"]).Should(Equal(":8080"))
+			Expect(alerts[1].Labels["instance"]).Should(Equal("<no value>"))
+		})
+
+		It("Should read large timestamps as milliseconds", func() {
+			alerts, err := input.Decode([]byte(`{ "results": [ { "timestamp": 1540313079901 } ] }`))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(alerts[0].StartsAt).Should(Equal("2018-10-23T16:44:39.901Z"))
+		})
+
+		It("Should use the configured timestamp unit", func() {
+			input.TimestampUnit = "ms"
+
+			alerts, err := input.Decode([]byte(`{ "results": [ { "timestamp": 1000 } ] }`))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(alerts[0].StartsAt).Should(Equal("1970-01-01T00:00:01Z"))
+		})
+
+		It("Should handle a body holding a single alert", func() {
+			input.Alerts = ""
+
+			alerts, err := input.Decode([]byte(`{ "state": "CRITICAL", "check": { "name": "HttpCheck" } }`))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(alerts).Should(HaveLen(1))
+			Expect(alerts[0].Labels["alertname"]).Should(Equal("HttpCheck"))
+		})
+
+		It("Should default to firing when there is no status", func() {
+			input.Status = ""
+
+			alerts, err := input.Decode([]byte(`{ "results": [ {} ] }`))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(alerts[0].Status).Should(Equal("firing"))
+		})
+
+		It("Should return an error when the body is not json", func() {
+			_, err := input.Decode([]byte("not json"))
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("#Validate", func() {
+		It("Should accept valid expressions", func() {
+			Expect(input.Validate()).Should(Succeed())
+		})
+
+		It("Should reject invalid paths", func() {
+			input.Labels["alertname"] = "$.check[name"
+			Expect(input.Validate()).Should(MatchError(ContainSubstring("missing ]")))
+		})
+
+		It("Should reject invalid templates", func() {
+			input.Labels["instance"] = "{{ .host "
+			Expect(input.Validate()).Should(HaveOccurred())
+		})
+
+		It("Should require a name", func() {
+			input.Name = ""
+			Expect(input.Validate()).Should(HaveOccurred())
+		})
+
+		It("Should reject unknown timestamp units", func() {
+			input.TimestampUnit = "us"
+			Expect(input.Validate()).Should(MatchError("Generic input checker: invalid timestamp_unit us"))
+		})
+
+		It("Should reject duplicate input names", func() {
+			Expect(ValidateGenericInputs([]GenericInput{input, input})).Should(MatchError("Duplicate generic input: checker"))
+		})
+	})
+
+	Context("#SendGenericEvents", func() {
+		var moogsoftServer FakeMoogsoftServer
+
+		BeforeEach(func() { moogsoftServer.Start() })
+		AfterEach(func() { moogsoftServer.Stop() })
+
+		It("Should map the extracted alerts to moogsoft events", func() {
+			client := Client{URL: moogsoftServer.URL(), EventsEndpoint: moogsoftServer.GetEventsEndpoint()}
+			Expect(input.Validate()).Should(Succeed())
+
+			statusCode, err := client.SendGenericEvents(context.Background(), input, `{
+        "results": [ { "state": "CRITICAL", "host": "someuri.com", "port": 8080, "check": { "name": "HttpCheck", "tags": ["warning"] } } ]
+      }`, moogsoftServer.GetToken())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(statusCode).Should(Equal(http.StatusOK))
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+			Expect(moogsoftServer.ReceivedEvents[0].Signature).Should(Equal("HttpCheck::someuri.com:8080"))
+			Expect(moogsoftServer.ReceivedEvents[0].Severity).Should(Equal(MAJOR))
+		})
+	})
+})
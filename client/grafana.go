@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// INPUT
+//
+// GrafanaPayload is the body sent by the webhook contact points of grafana
+// unified alerting. Its alerts share the alertmanager fields so they are
+// mapped like any prometheus alert.
+type GrafanaPayload struct {
+	Receiver    string            `json:"receiver"`
+	Status      string            `json:"status"`
+	OrgID       int64             `json:"orgId"`
+	Alerts      []PrometheusAlert `json:"alerts"`
+	GroupKey    string            `json:"groupKey"`
+	ExternalURL string            `json:"externalURL"`
+	Title       string            `json:"title"`
+	State       string            `json:"state"`
+	Message     string            `json:"message"`
+}
+
+// SendGrafanaEvents sends the alerts in the grafana payload to moogsoft.
+func (c *Client) SendGrafanaEvents(ctx context.Context, payload string, token string) (int, error) {
+	var grafanaPayload GrafanaPayload
+
+	err := json.Unmarshal([]byte(payload), &grafanaPayload)
+	if err != nil {
+		loggerFor(ctx).Error("Invalid grafana payload", "error", err.Error(), "payload_size", len(payload))
+		return 500, err
+	}
+
+	for i := range grafanaPayload.Alerts {
+		grafanaPayload.Alerts[i].OrgID = grafanaPayload.OrgID
+	}
+
+	return c.SendAlerts(ctx, withGroup(grafanaPayload.Alerts, grafanaPayload.GroupKey, grafanaPayload.ExternalURL), token)
+}
@@ -0,0 +1,61 @@
+package client_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("SendGrafanaEvents", func() {
+	var client Client
+	var moogsoftServer FakeMoogsoftServer
+	var grafanaPayload []byte
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+
+		client = Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+			Env:            "dev",
+		}
+
+		var err error
+		grafanaPayload, err = ioutil.ReadFile("testdata/grafana_alerts.json")
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+	})
+
+	It("Should map grafana alerts like prometheus alerts", func() {
+		statusCode, err := client.SendGrafanaEvents(context.Background(), string(grafanaPayload), moogsoftServer.GetToken())
+		Expect(err).Should(BeNil())
+		Expect(statusCode).Should(Equal(http.StatusOK))
+
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+		event := moogsoftServer.ReceivedEvents[0]
+
+		Expect(event.Signature).Should(Equal("ProbeUnsuccesful::someuri.com:8080"))
+		Expect(event.Type).Should(Equal("probe"))
+		Expect(event.Severity).Should(Equal(CRITICAL))
+		Expect(event.Description).Should(Equal("Probe to someuri.com:8080 has been failing for the last 5m"))
+		Expect(event.AonToolUrl).Should(Equal("https://grafana.your-domain.com/alerting/grafana/abc123/view?orgId=1"))
+		Expect(event.AgentTime).Should(Equal("1540313079"))
+		Expect(event.CustomInfo).Should(HaveKeyWithValue("grafana_org_id", BeNumerically("==", 1)))
+	})
+
+	Context("when the payload is invalid", func() {
+		It("Should return an error", func() {
+			statusCode, err := client.SendGrafanaEvents(context.Background(), "not json", moogsoftServer.GetToken())
+			Expect(err).Should(HaveOccurred())
+			Expect(statusCode).Should(Equal(http.StatusInternalServerError))
+		})
+	})
+})
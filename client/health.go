@@ -0,0 +1,119 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// deliveryStatus tracks the outcome of the requests sent to moogsoft.
+type deliveryStatus struct {
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+}
+
+func (s *deliveryStatus) record(statusCode int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !deliveryFailed(statusCode, err) {
+		s.lastSuccess = time.Now()
+		return
+	}
+
+	s.lastFailure = time.Now()
+	if err != nil {
+		s.lastError = err.Error()
+	} else {
+		s.lastError = fmt.Sprintf("Moogsoft responded with status code %d", statusCode)
+	}
+}
+
+// DestinationStatus reports the state of the deliveries to a moogsoft
+// destination.
+type DestinationStatus struct {
+	URL            string     `json:"url"`
+	EventsEndpoint string     `json:"events_endpoint"`
+	CircuitBreaker string     `json:"circuit_breaker"`
+	QueueDepth     int        `json:"queue_depth"`
+	DeadLetters    int64      `json:"dead_letters"`
+	LastSuccess    *time.Time `json:"last_success"`
+	LastFailure    *time.Time `json:"last_failure"`
+	LastError      string     `json:"last_error"`
+}
+
+// Status returns the current state of the deliveries to moogsoft.
+func (c *Client) Status() DestinationStatus {
+	status := DestinationStatus{
+		URL:            c.URL,
+		EventsEndpoint: c.EventsEndpoint,
+		CircuitBreaker: "disabled",
+	}
+
+	if c.Breaker != nil {
+		status.CircuitBreaker = c.Breaker.State().String()
+	}
+
+	if c.Queue != nil {
+		status.QueueDepth = c.Queue.Len()
+		status.DeadLetters = c.Queue.DeadLetters()
+	}
+
+	c.delivery.mu.Lock()
+	defer c.delivery.mu.Unlock()
+
+	if !c.delivery.lastSuccess.IsZero() {
+		lastSuccess := c.delivery.lastSuccess
+		status.LastSuccess = &lastSuccess
+	}
+
+	if !c.delivery.lastFailure.IsZero() {
+		lastFailure := c.delivery.lastFailure
+		status.LastFailure = &lastFailure
+		status.LastError = c.delivery.lastError
+	}
+
+	return status
+}
+
+// ReadinessChecks selects what besides a full retry queue makes the instance
+// not ready. Both are disabled by default: taking the instances out of the
+// load balancer does not fix moogsoft being down.
+type ReadinessChecks struct {
+	// CircuitBreaker makes the instance not ready while the breaker is not
+	// closed.
+	CircuitBreaker bool
+	// MaxDeliveryAge makes the instance not ready when the last delivery
+	// failed and none succeeded within it, zero disables the check.
+	MaxDeliveryAge time.Duration
+}
+
+// NotReadyReasons returns why the instance can not accept more events right
+// now, or nothing if it is ready.
+func (c *Client) NotReadyReasons(checks ReadinessChecks) []string {
+	var reasons []string
+
+	if c.Queue != nil && c.Queue.Full() {
+		reasons = append(reasons, "retry queue is full")
+	}
+
+	if checks.CircuitBreaker && c.Breaker != nil {
+		if state := c.Breaker.State(); state != CLOSED {
+			reasons = append(reasons, fmt.Sprintf("circuit breaker is %s", state))
+		}
+	}
+
+	if checks.MaxDeliveryAge > 0 {
+		c.delivery.mu.Lock()
+		defer c.delivery.mu.Unlock()
+
+		lastFailed := c.delivery.lastFailure.After(c.delivery.lastSuccess)
+		if lastFailed && time.Since(c.delivery.lastSuccess) > checks.MaxDeliveryAge {
+			reasons = append(reasons, fmt.Sprintf("no successful delivery to moogsoft in the last %s: %s", checks.MaxDeliveryAge, c.delivery.lastError))
+		}
+	}
+
+	return reasons
+}
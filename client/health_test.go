@@ -0,0 +1,98 @@
+package client_test
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("NotReadyReasons", func() {
+	var client Client
+	var moogsoftServer FakeMoogsoftServer
+
+	prometheusEvent := `{ "alerts": [ { "status": "firing", "labels": { "service": "probe" } } ] }`
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+
+		client = Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+		}
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+	})
+
+	It("Should be ready before any delivery", func() {
+		Expect(client.NotReadyReasons(ReadinessChecks{})).Should(BeEmpty())
+	})
+
+	Context("when the deliveries fail", func() {
+		BeforeEach(func() {
+			moogsoftServer.FailWith = http.StatusInternalServerError
+			client.Breaker = NewCircuitBreaker(1, time.Hour)
+			client.SendEvents(prometheusEvent, moogsoftServer.GetToken())
+		})
+
+		It("Should stay ready", func() {
+			Expect(client.Breaker.State()).Should(Equal(OPEN))
+			Expect(client.NotReadyReasons(ReadinessChecks{})).Should(BeEmpty())
+		})
+
+		It("Should not be ready when the circuit breaker check is enabled", func() {
+			checks := ReadinessChecks{CircuitBreaker: true}
+			Expect(client.NotReadyReasons(checks)).Should(ConsistOf("circuit breaker is open"))
+		})
+
+		It("Should report the failure in the status", func() {
+			status := client.Status()
+			Expect(status.CircuitBreaker).Should(Equal("open"))
+			Expect(status.LastSuccess).Should(BeNil())
+			Expect(status.LastError).Should(Equal("Moogsoft responded with status code 500"))
+		})
+	})
+
+	Context("when the last delivery failed", func() {
+		checks := ReadinessChecks{MaxDeliveryAge: 5 * time.Millisecond}
+
+		BeforeEach(func() {
+			moogsoftServer.FailWith = http.StatusInternalServerError
+			client.SendEvents(prometheusEvent, moogsoftServer.GetToken())
+		})
+
+		It("Should not be ready once the max delivery age is exceeded", func() {
+			time.Sleep(10 * time.Millisecond)
+			Expect(client.NotReadyReasons(checks)).Should(ConsistOf(
+				ContainSubstring("Moogsoft responded with status code 500"),
+			))
+		})
+
+		It("Should be ready again after a successful delivery", func() {
+			moogsoftServer.FailWith = 0
+			client.SendEvents(prometheusEvent, moogsoftServer.GetToken())
+
+			time.Sleep(10 * time.Millisecond)
+			Expect(client.NotReadyReasons(checks)).Should(BeEmpty())
+		})
+
+		It("Should stay ready when the check is disabled", func() {
+			time.Sleep(10 * time.Millisecond)
+			Expect(client.NotReadyReasons(ReadinessChecks{})).Should(BeEmpty())
+		})
+	})
+
+	Context("when the retry queue is full", func() {
+		It("Should not be ready", func() {
+			client.Queue = NewRetryQueue(1, 0)
+			client.Queue.Push([]byte("{}"), "", "")
+
+			Expect(client.NotReadyReasons(ReadinessChecks{})).Should(ConsistOf("retry queue is full"))
+		})
+	})
+})
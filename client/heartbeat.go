@@ -0,0 +1,281 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Heartbeat is an always firing alert, like the prometheus Watchdog, whose
+// absence means the monitoring pipeline sending it is broken.
+type Heartbeat struct {
+	Alertname string `yaml:"alertname"`
+	// Interval is the longest time allowed between two receptions.
+	Interval time.Duration `yaml:"interval"`
+	// GroupBy is the label telling apart the pipelines sending the same
+	// heartbeat, defaults to environment.
+	GroupBy string `yaml:"group_by"`
+	// Environments are tracked from startup, other values of GroupBy only
+	// once their first heartbeat is received.
+	Environments []string `yaml:"environments"`
+}
+
+// HeartbeatConfig is the heartbeats section of the config file.
+type HeartbeatConfig struct {
+	CheckInterval time.Duration `yaml:"check_interval"`
+	Alerts        []Heartbeat   `yaml:"alerts"`
+}
+
+// Validate checks every heartbeat has an alertname and an interval.
+func (c HeartbeatConfig) Validate() error {
+	for _, heartbeat := range c.Alerts {
+		if heartbeat.Alertname == "" {
+			return fmt.Errorf("Heartbeat without alertname")
+		}
+		if heartbeat.Interval <= 0 {
+			return fmt.Errorf("Heartbeat %s without interval", heartbeat.Alertname)
+		}
+	}
+
+	return nil
+}
+
+func (h Heartbeat) groupBy() string {
+	if h.GroupBy == "" {
+		return "environment"
+	}
+
+	return h.GroupBy
+}
+
+type heartbeatKey struct {
+	alertname   string
+	environment string
+}
+
+type heartbeatState struct {
+	heartbeat Heartbeat
+	lastSeen  time.Time
+	missing   bool
+}
+
+// HeartbeatMonitor tracks the heartbeat alerts, which are not forwarded to
+// moogsoft, and reports the ones not received within their interval.
+//
+// Each instance only receives the heartbeats the load balancer sends it. With
+// an AlertmanagerURL a heartbeat is also received when alertmanager last
+// updated it, whichever instance it notified.
+type HeartbeatMonitor struct {
+	AlertmanagerURL string
+	// Receiver restricts the alertmanager alerts like the reconciler one.
+	Receiver   string
+	HTTPClient *http.Client
+
+	heartbeats map[string]Heartbeat
+
+	mu     sync.Mutex
+	states map[heartbeatKey]*heartbeatState
+}
+
+// NewHeartbeatMonitor returns a monitor of the heartbeats, starting the
+// interval of their configured environments now.
+func NewHeartbeatMonitor(heartbeats []Heartbeat) *HeartbeatMonitor {
+	m := &HeartbeatMonitor{
+		heartbeats: map[string]Heartbeat{},
+		states:     map[heartbeatKey]*heartbeatState{},
+	}
+
+	now := time.Now()
+	for _, heartbeat := range heartbeats {
+		m.heartbeats[heartbeat.Alertname] = heartbeat
+		for _, environment := range heartbeat.Environments {
+			m.states[heartbeatKey{heartbeat.Alertname, environment}] = &heartbeatState{heartbeat: heartbeat, lastSeen: now}
+		}
+	}
+
+	return m
+}
+
+// IsHeartbeat reports whether the alert is a heartbeat, and not the event
+// sent for a missing one.
+func (m *HeartbeatMonitor) IsHeartbeat(alert PrometheusAlert) bool {
+	if m == nil || alert.Labels["service"] == "heartbeat" {
+		return false
+	}
+
+	_, ok := m.heartbeats[alert.Labels["alertname"]]
+	return ok
+}
+
+// Observe records the reception of a firing heartbeat at now. It returns the
+// alert resolving the missing heartbeat event when it was missing.
+func (m *HeartbeatMonitor) Observe(alert PrometheusAlert, now time.Time) (PrometheusAlert, bool) {
+	heartbeat, ok := m.heartbeats[alert.Labels["alertname"]]
+	if !ok || alert.Status != "firing" {
+		return PrometheusAlert{}, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := heartbeatKey{heartbeat.Alertname, alert.Labels[heartbeat.groupBy()]}
+	state, ok := m.states[key]
+	if !ok {
+		state = &heartbeatState{heartbeat: heartbeat}
+		m.states[key] = state
+	}
+
+	// Alertmanager may report a heartbeat older than the last one received.
+	if !now.After(state.lastSeen) {
+		return PrometheusAlert{}, false
+	}
+
+	state.lastSeen = now
+	if !state.missing {
+		return PrometheusAlert{}, false
+	}
+
+	state.missing = false
+	return missingHeartbeatAlert(key, "resolved", now, heartbeat.Interval), true
+}
+
+// Expired returns the alerts for the heartbeats that went missing since the
+// previous call.
+func (m *HeartbeatMonitor) Expired(now time.Time) []PrometheusAlert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var alerts []PrometheusAlert
+
+	for key, state := range m.states {
+		if state.missing || now.Sub(state.lastSeen) <= state.heartbeat.Interval {
+			continue
+		}
+
+		state.missing = true
+		alerts = append(alerts, missingHeartbeatAlert(key, "firing", now, state.heartbeat.Interval))
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Labels["environment"] < alerts[j].Labels["environment"]
+	})
+
+	return alerts
+}
+
+func missingHeartbeatAlert(key heartbeatKey, status string, now time.Time, interval time.Duration) PrometheusAlert {
+	return PrometheusAlert{
+		Status: status,
+		Labels: map[string]string{
+			"alertname":   key.alertname,
+			"environment": key.environment,
+			"service":     "heartbeat",
+			"severity":    "critical",
+		},
+		Annotations: map[string]string{
+			"description": fmt.Sprintf("%s heartbeat not received for %s, the monitoring pipeline of %s is broken", key.alertname, interval, key.environment),
+		},
+		StartsAt: now.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// CheckHeartbeats sends a CRITICAL event for every heartbeat that went
+// missing.
+func (c *Client) CheckHeartbeats(ctx context.Context, now time.Time, token string) error {
+	if c.Heartbeats == nil {
+		return nil
+	}
+
+	// Alertmanager being down may well be why the heartbeats are missing.
+	recovered, err := c.observeAlertmanagerHeartbeats(ctx, now)
+	if err != nil {
+		loggerFor(ctx).Warn("Unable to read the heartbeats from alertmanager", "alertmanager_url", c.Heartbeats.AlertmanagerURL, "error", err.Error())
+	}
+
+	expired := c.Heartbeats.Expired(now)
+	if len(expired) > 0 {
+		loggerFor(ctx).Warn("Heartbeats missing", "alerts", len(expired))
+	}
+
+	alerts := append(recovered, expired...)
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	statusCode, err := c.SendAlerts(ctx, alerts, token)
+	if err != nil {
+		return err
+	}
+	if statusCode >= 400 {
+		return fmt.Errorf("Moogsoft responded with status code %d", statusCode)
+	}
+
+	return nil
+}
+
+// observeAlertmanagerHeartbeats records the heartbeats alertmanager received
+// within their interval, and returns the alerts resolving the missing ones.
+func (c *Client) observeAlertmanagerHeartbeats(ctx context.Context, now time.Time) ([]PrometheusAlert, error) {
+	m := c.Heartbeats
+	if m.AlertmanagerURL == "" {
+		return nil, nil
+	}
+
+	httpClient := m.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultAlertmanagerTimeout}
+	}
+
+	alertmanagerAlerts, err := fetchAlertmanagerAlerts(ctx, httpClient, strings.TrimSuffix(m.AlertmanagerURL, "/"), m.Receiver)
+	if err != nil {
+		return nil, err
+	}
+
+	var recovered []PrometheusAlert
+
+	for _, alertmanagerAlert := range alertmanagerAlerts {
+		updated, err := time.Parse(time.RFC3339Nano, alertmanagerAlert.UpdatedAt)
+		if err != nil {
+			continue
+		}
+
+		alert := relabel(PrometheusAlert{
+			Status:      "firing",
+			Labels:      alertmanagerAlert.Labels,
+			Annotations: alertmanagerAlert.Annotations,
+		}, c.Relabel)
+		heartbeat, ok := m.heartbeats[alert.Labels["alertname"]]
+		if !ok || !m.IsHeartbeat(alert) || now.Sub(updated) > heartbeat.Interval {
+			continue
+		}
+
+		if resolved, ok := m.Observe(alert, updated); ok {
+			loggerFor(ctx).Info("Heartbeat received again", "alertname", alert.Labels["alertname"])
+			recovered = append(recovered, resolved)
+		}
+	}
+
+	return recovered, nil
+}
+
+// RunHeartbeats checks the heartbeats every interval until stop is closed.
+func (c *Client) RunHeartbeats(interval time.Duration, token string, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			ctx := WithRequestID(context.Background(), NewRequestID())
+			if err := c.CheckHeartbeats(ctx, now, token); err != nil {
+				loggerFor(ctx).Error("Unable to send missing heartbeats", "error", err.Error())
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package client_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("HeartbeatMonitor", func() {
+	var client *Client
+	var moogsoftServer FakeMoogsoftServer
+
+	watchdog := PrometheusAlert{
+		Status:   "firing",
+		Labels:   map[string]string{"alertname": "Watchdog", "environment": "prod", "severity": "none"},
+		StartsAt: "2018-10-23T16:44:39.901211833Z",
+	}
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+
+		client = &Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+			Registry:       NewRegistry(),
+			Heartbeats: NewHeartbeatMonitor([]Heartbeat{
+				{Alertname: "Watchdog", Interval: 5 * time.Minute, Environments: []string{"staging"}},
+			}),
+		}
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+	})
+
+	It("Should not forward heartbeats", func() {
+		statusCode, err := client.SendAlerts(context.Background(), []PrometheusAlert{watchdog}, moogsoftServer.GetToken())
+
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(statusCode).Should(Equal(200))
+		Expect(moogsoftServer.ReceivedEvents).Should(BeEmpty())
+	})
+
+	It("Should not report heartbeats received within their interval", func() {
+		client.SendAlerts(context.Background(), []PrometheusAlert{watchdog}, moogsoftServer.GetToken())
+
+		Expect(client.CheckHeartbeats(context.Background(), time.Now().Add(time.Minute), moogsoftServer.GetToken())).Should(Succeed())
+
+		Expect(moogsoftServer.ReceivedEvents).Should(BeEmpty())
+	})
+
+	Context("when a heartbeat is not received within its interval", func() {
+		BeforeEach(func() {
+			client.SendAlerts(context.Background(), []PrometheusAlert{watchdog}, moogsoftServer.GetToken())
+		})
+
+		It("Should send a CRITICAL event once per environment", func() {
+			Expect(client.CheckHeartbeats(context.Background(), time.Now().Add(10*time.Minute), moogsoftServer.GetToken())).Should(Succeed())
+			Expect(client.CheckHeartbeats(context.Background(), time.Now().Add(20*time.Minute), moogsoftServer.GetToken())).Should(Succeed())
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(2))
+			Expect(moogsoftServer.ReceivedEvents[0].Signature).Should(Equal("Watchdog::prod"))
+			Expect(moogsoftServer.ReceivedEvents[0].Severity).Should(Equal(CRITICAL))
+			Expect(moogsoftServer.ReceivedEvents[0].Description).Should(ContainSubstring("monitoring pipeline of prod is broken"))
+			Expect(moogsoftServer.ReceivedEvents[1].Signature).Should(Equal("Watchdog::staging"))
+		})
+
+		It("Should clear the event when the heartbeat is received again", func() {
+			Expect(client.CheckHeartbeats(context.Background(), time.Now().Add(10*time.Minute), moogsoftServer.GetToken())).Should(Succeed())
+
+			_, err := client.SendAlerts(context.Background(), []PrometheusAlert{watchdog}, moogsoftServer.GetToken())
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(3))
+			Expect(moogsoftServer.ReceivedEvents[2].Signature).Should(Equal("Watchdog::prod"))
+			Expect(moogsoftServer.ReceivedEvents[2].Severity).Should(Equal(CLEAR))
+			_, open := client.Registry.Get("Watchdog::prod")
+			Expect(open).Should(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("HeartbeatMonitor with alertmanager", func() {
+	var client *Client
+	var moogsoftServer FakeMoogsoftServer
+	var alertmanagerServer FakeAlertmanagerServer
+
+	checkTime := time.Now().Add(10 * time.Minute)
+
+	watchdogUpdatedAt := func(updatedAt time.Time) AlertmanagerAlert {
+		return AlertmanagerAlert{
+			Labels:    map[string]string{"alertname": "Watchdog", "environment": "staging", "severity": "none"},
+			UpdatedAt: updatedAt.Format(time.RFC3339Nano),
+		}
+	}
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+		alertmanagerServer.Start()
+
+		client = &Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+			Heartbeats: NewHeartbeatMonitor([]Heartbeat{
+				{Alertname: "Watchdog", Interval: 5 * time.Minute, Environments: []string{"staging"}},
+			}),
+		}
+		client.Heartbeats.AlertmanagerURL = alertmanagerServer.URL()
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+		alertmanagerServer.Stop()
+	})
+
+	It("Should not report the heartbeats alertmanager received within their interval", func() {
+		alertmanagerServer.Alerts = []AlertmanagerAlert{watchdogUpdatedAt(checkTime.Add(-time.Minute))}
+
+		Expect(client.CheckHeartbeats(context.Background(), checkTime, moogsoftServer.GetToken())).Should(Succeed())
+
+		Expect(moogsoftServer.ReceivedEvents).Should(BeEmpty())
+	})
+
+	It("Should report the heartbeats alertmanager last updated before their interval", func() {
+		alertmanagerServer.Alerts = []AlertmanagerAlert{watchdogUpdatedAt(checkTime.Add(-10 * time.Minute))}
+
+		Expect(client.CheckHeartbeats(context.Background(), checkTime, moogsoftServer.GetToken())).Should(Succeed())
+
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+		Expect(moogsoftServer.ReceivedEvents[0].Severity).Should(Equal(CRITICAL))
+	})
+
+	It("Should clear the event when alertmanager receives the heartbeat again", func() {
+		Expect(client.CheckHeartbeats(context.Background(), checkTime, moogsoftServer.GetToken())).Should(Succeed())
+
+		alertmanagerServer.Alerts = []AlertmanagerAlert{watchdogUpdatedAt(checkTime.Add(time.Minute))}
+		Expect(client.CheckHeartbeats(context.Background(), checkTime.Add(2*time.Minute), moogsoftServer.GetToken())).Should(Succeed())
+		Expect(client.CheckHeartbeats(context.Background(), checkTime.Add(3*time.Minute), moogsoftServer.GetToken())).Should(Succeed())
+
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(2))
+		Expect(moogsoftServer.ReceivedEvents[0].Signature).Should(Equal("Watchdog::staging"))
+		Expect(moogsoftServer.ReceivedEvents[0].Severity).Should(Equal(CRITICAL))
+		Expect(moogsoftServer.ReceivedEvents[1].Signature).Should(Equal("Watchdog::staging"))
+		Expect(moogsoftServer.ReceivedEvents[1].Severity).Should(Equal(CLEAR))
+	})
+
+	Context("when alertmanager is not reachable", func() {
+		It("Should report the missing heartbeats", func() {
+			alertmanagerServer.Stop()
+			Expect(client.CheckHeartbeats(context.Background(), checkTime, moogsoftServer.GetToken())).Should(Succeed())
+			alertmanagerServer.Start()
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+			Expect(moogsoftServer.ReceivedEvents[0].Severity).Should(Equal(CRITICAL))
+		})
+	})
+})
@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPConfig derives the AonIPAddress of the events from their labels, and the
+// AonIPSubnet from the subnets containing it, so moogsoft can correlate the
+// alerts by topology.
+type IPConfig struct {
+	// Labels are tried in order, their value may be an ip, a host, host:port
+	// or an url.
+	Labels []string `yaml:"labels"`
+	// Resolve looks up the ip of host names.
+	Resolve        bool          `yaml:"resolve"`
+	ResolveTimeout time.Duration `yaml:"resolve_timeout"`
+	CacheTTL       time.Duration `yaml:"cache_ttl"`
+	// Subnets are CIDRs, the most specific one containing the ip is the
+	// AonIPSubnet.
+	Subnets []string `yaml:"subnets"`
+
+	// LookupHost resolves host names, defaults to net.DefaultResolver.
+	LookupHost func(ctx context.Context, host string) ([]string, error) `yaml:"-"`
+
+	subnets []*net.IPNet
+
+	mu    sync.Mutex
+	cache map[string]resolvedHost
+}
+
+type resolvedHost struct {
+	ip      string
+	expires time.Time
+}
+
+// Validate parses the subnets.
+func (c *IPConfig) Validate() error {
+	c.subnets = nil
+
+	for _, cidr := range c.Subnets {
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("Invalid ip subnet: %s", err.Error())
+		}
+		c.subnets = append(c.subnets, subnet)
+	}
+
+	return nil
+}
+
+// apply sets the ip address of the event when missing, and its subnet.
+func (c *IPConfig) apply(ctx context.Context, event *MoogsoftEvent, alert PrometheusAlert) {
+	if c == nil {
+		return
+	}
+
+	if event.AonIPAddress == "" {
+		for _, label := range c.Labels {
+			if ip := c.ipFor(ctx, alert.Labels[label]); ip != "" {
+				event.AonIPAddress = ip
+				break
+			}
+		}
+	}
+
+	if event.AonIPSubnet == "" {
+		event.AonIPSubnet = c.subnetFor(event.AonIPAddress)
+	}
+}
+
+func (c *IPConfig) ipFor(ctx context.Context, value string) string {
+	host := hostOf(value)
+	if host == "" {
+		return ""
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+
+	if !c.Resolve {
+		return ""
+	}
+
+	return c.resolve(ctx, host)
+}
+
+// hostOf strips the scheme, port and path around the host in value.
+func hostOf(value string) string {
+	value = strings.TrimSpace(value)
+
+	if strings.Contains(value, "://") {
+		u, err := url.Parse(value)
+		if err != nil {
+			return ""
+		}
+		return u.Hostname()
+	}
+
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		return host
+	}
+
+	return strings.Trim(value, "[]")
+}
+
+// resolve returns the first ip of host, preferring IPv4. Failed lookups are
+// cached too, so an unknown host does not slow down every event.
+func (c *IPConfig) resolve(ctx context.Context, host string) string {
+	c.mu.Lock()
+	entry, ok := c.cache[host]
+	c.mu.Unlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		return entry.ip
+	}
+
+	timeout := c.ResolveTimeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	lookupHost := c.LookupHost
+	if lookupHost == nil {
+		lookupHost = net.DefaultResolver.LookupHost
+	}
+
+	ip := ""
+	addresses, err := lookupHost(ctx, host)
+	if err != nil {
+		loggerFor(ctx).Debug("Unable to resolve host", "host", host, "error", err.Error())
+	}
+	for _, address := range addresses {
+		if parsed := net.ParseIP(address); parsed != nil && (ip == "" || parsed.To4() != nil) {
+			ip = parsed.String()
+			if parsed.To4() != nil {
+				break
+			}
+		}
+	}
+
+	ttl := c.CacheTTL
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = map[string]resolvedHost{}
+	}
+	c.cache[host] = resolvedHost{ip: ip, expires: time.Now().Add(ttl)}
+	c.mu.Unlock()
+
+	return ip
+}
+
+func (c *IPConfig) subnetFor(address string) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return ""
+	}
+
+	var match *net.IPNet
+	for _, subnet := range c.subnets {
+		if subnet.Contains(ip) && (match == nil || maskSize(subnet) > maskSize(match)) {
+			match = subnet
+		}
+	}
+
+	if match == nil {
+		return ""
+	}
+
+	return match.String()
+}
+
+func maskSize(subnet *net.IPNet) int {
+	ones, _ := subnet.Mask.Size()
+	return ones
+}
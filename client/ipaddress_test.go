@@ -0,0 +1,125 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("IPConfig", func() {
+	var client *Client
+	var moogsoftServer FakeMoogsoftServer
+	var lookups map[string]int
+
+	probe := func(instance string) PrometheusAlert {
+		return PrometheusAlert{
+			Status:   "firing",
+			Labels:   map[string]string{"alertname": "ProbeUnsuccesful", "instance": instance, "service": "probe", "severity": "warning"},
+			StartsAt: "2018-10-23T16:44:39.901211833Z",
+		}
+	}
+
+	send := func(alerts ...PrometheusAlert) MoogsoftEvent {
+		_, err := client.SendAlerts(context.Background(), alerts, moogsoftServer.GetToken())
+		Expect(err).ShouldNot(HaveOccurred())
+		return moogsoftServer.ReceivedEvents[len(moogsoftServer.ReceivedEvents)-1]
+	}
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+		lookups = map[string]int{}
+
+		ip := &IPConfig{
+			Labels:  []string{"ip", "instance"},
+			Resolve: true,
+			Subnets: []string{"10.0.0.0/8", "10.198.0.0/16", "fd00::/8"},
+			LookupHost: func(ctx context.Context, host string) ([]string, error) {
+				lookups[host]++
+				if host == "someuri.com" {
+					return []string{"2001:db8::1", "10.198.4.20"}, nil
+				}
+				return nil, errors.New("no such host")
+			},
+		}
+		Expect(ip.Validate()).Should(Succeed())
+
+		client = &Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+			IP:             ip,
+		}
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+	})
+
+	DescribeTable("Should extract the ip from the label",
+		func(instance string, ip string, subnet string) {
+			event := send(probe(instance))
+			Expect(event.AonIPAddress).Should(Equal(ip))
+			Expect(event.AonIPSubnet).Should(Equal(subnet))
+		},
+		Entry("host:port", "10.198.159.80:9391", "10.198.159.80", "10.198.0.0/16"),
+		Entry("ip", "10.1.2.3", "10.1.2.3", "10.0.0.0/8"),
+		Entry("url", "https://10.198.1.1:8443/health", "10.198.1.1", "10.198.0.0/16"),
+		Entry("ipv6 with port", "[fd00::1]:9100", "fd00::1", "fd00::/8"),
+		Entry("ip outside the subnets", "192.168.1.1:80", "192.168.1.1", ""),
+		Entry("resolved host preferring ipv4", "someuri.com:8080", "10.198.4.20", "10.198.0.0/16"),
+		Entry("unknown host", "unknown.com:8080", "", ""),
+	)
+
+	It("Should try the labels in order", func() {
+		alert := probe("10.198.159.80:9391")
+		alert.Labels["ip"] = "10.2.2.2"
+
+		Expect(send(alert).AonIPAddress).Should(Equal("10.2.2.2"))
+	})
+
+	It("Should cache the resolved hosts", func() {
+		send(probe("someuri.com:8080"), probe("someuri.com:9090"), probe("unknown.com:80"), probe("unknown.com:80"))
+
+		Expect(lookups).Should(Equal(map[string]int{"someuri.com": 1, "unknown.com": 1}))
+	})
+
+	It("Should keep the bosh_job_ip of the bosh services and compute its subnet", func() {
+		event := send(PrometheusAlert{
+			Status:   "firing",
+			Labels:   map[string]string{"alertname": "BoshJobDown", "service": "bosh-job", "bosh_job_ip": "10.198.3.3", "instance": "10.1.1.1:9190", "severity": "warning"},
+			StartsAt: "2018-10-23T16:44:39.901211833Z",
+		})
+
+		Expect(event.AonIPAddress).Should(Equal("10.198.3.3"))
+		Expect(event.AonIPSubnet).Should(Equal("10.198.0.0/16"))
+	})
+
+	It("Should not resolve hosts when reconciling", func() {
+		var alertmanagerServer FakeAlertmanagerServer
+		alertmanagerServer.Start()
+		defer alertmanagerServer.Stop()
+
+		client.Registry = NewRegistry()
+		client.IP.CacheTTL = time.Nanosecond
+		send(probe("someuri.com:8080"))
+
+		active := AlertmanagerAlert{Labels: probe("someuri.com:8080").Labels, StartsAt: "2018-10-23T16:44:39.901211833Z"}
+		active.Status.State = "active"
+		alertmanagerServer.Alerts = []AlertmanagerAlert{active}
+
+		reconciler := NewReconciler(alertmanagerServer.URL(), client, moogsoftServer.GetToken())
+		Expect(reconciler.Reconcile(context.Background())).Should(Succeed())
+
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+		Expect(lookups).Should(Equal(map[string]int{"someuri.com": 1}))
+	})
+
+	It("Should reject invalid subnets", func() {
+		Expect((&IPConfig{Subnets: []string{"10.0.0.0/33"}}).Validate()).ShouldNot(Succeed())
+	})
+})
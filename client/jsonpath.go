@@ -0,0 +1,116 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type pathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses the supported JSONPath subset: $ for the document
+// root, .name or ['name'] for object members, [n] for array items and .* or
+// [*] for every member or item.
+func parseJSONPath(path string) ([]pathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("Invalid path %q: it must start with $", path)
+	}
+
+	var steps []pathStep
+	rest := path[1:]
+
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" {
+				return nil, fmt.Errorf("Invalid path %q: empty member name", path)
+			}
+			if name == "*" {
+				steps = append(steps, pathStep{wildcard: true})
+			} else {
+				steps = append(steps, pathStep{key: name})
+			}
+			rest = rest[end+1:]
+
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("Invalid path %q: missing ]", path)
+			}
+			selector := rest[1:end]
+			rest = rest[end+1:]
+
+			if selector == "*" {
+				steps = append(steps, pathStep{wildcard: true})
+			} else if len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0] {
+				steps = append(steps, pathStep{key: selector[1 : len(selector)-1]})
+			} else {
+				index, err := strconv.Atoi(selector)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid path %q: unsupported selector [%s]", path, selector)
+				}
+				steps = append(steps, pathStep{index: index, isIndex: true})
+			}
+
+		default:
+			return nil, fmt.Errorf("Invalid path %q: unexpected %q", path, rest[0])
+		}
+	}
+
+	return steps, nil
+}
+
+// jsonPath returns the values matching path in a document decoded with
+// encoding/json. Missing members or items match nothing.
+func jsonPath(document interface{}, path string) ([]interface{}, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []interface{}{document}
+
+	for _, step := range steps {
+		var next []interface{}
+
+		for _, match := range matches {
+			switch value := match.(type) {
+			case map[string]interface{}:
+				if step.wildcard {
+					for _, member := range value {
+						next = append(next, member)
+					}
+				} else if member, ok := value[step.key]; ok && !step.isIndex {
+					next = append(next, member)
+				}
+
+			case []interface{}:
+				if step.wildcard {
+					next = append(next, value...)
+				} else if step.isIndex {
+					index := step.index
+					if index < 0 {
+						index += len(value)
+					}
+					if index >= 0 && index < len(value) {
+						next = append(next, value[index])
+					}
+				}
+			}
+		}
+
+		matches = next
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+// NewRequestID returns a random id used to correlate the logs of a webhook.
+func NewRequestID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// WithRequestID returns a copy of ctx carrying the request id.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID returns the request id carried by ctx, if any.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// loggerFor returns the default logger tagged with the request id carried by
+// ctx.
+func loggerFor(ctx context.Context) *slog.Logger {
+	if requestID := RequestID(ctx); requestID != "" {
+		return slog.Default().With("request_id", requestID)
+	}
+
+	return slog.Default()
+}
+
+// redact returns a copy of the alerts with the values of the labels and
+// annotations in keys replaced, so payloads can be logged safely.
+func redact(alerts []PrometheusAlert, keys []string) []PrometheusAlert {
+	redacted := make([]PrometheusAlert, len(alerts))
+
+	for i, alert := range alerts {
+		alert.Labels = redactValues(alert.Labels, keys)
+		alert.Annotations = redactValues(alert.Annotations, keys)
+		redacted[i] = alert
+	}
+
+	return redacted
+}
+
+func redactValues(values map[string]string, keys []string) map[string]string {
+	redacted := make(map[string]string, len(values))
+
+	for k, v := range values {
+		redacted[k] = v
+	}
+
+	for _, key := range keys {
+		if _, ok := redacted[key]; ok {
+			redacted[key] = "[REDACTED]"
+		}
+	}
+
+	return redacted
+}
@@ -0,0 +1,71 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("Logging", func() {
+	var client Client
+	var moogsoftServer FakeMoogsoftServer
+	var logs *bytes.Buffer
+	var defaultLogger *slog.Logger
+
+	prometheusEvent := `{
+    "alerts": [
+      {
+        "status": "firing",
+        "labels": { "alertname": "SomeAlert", "service": "unknown", "severity": "warning", "password": "s3cr3t" },
+        "annotations": { "description": "some alert description" },
+        "startsAt": "2018-10-23T16:44:39.901211833Z"
+      }
+    ]
+  }`
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+
+		logs = &bytes.Buffer{}
+		defaultLogger = slog.Default()
+		slog.SetDefault(slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+		client = Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+			RedactKeys:     []string{"password"},
+		}
+	})
+
+	AfterEach(func() {
+		slog.SetDefault(defaultLogger)
+		moogsoftServer.Stop()
+	})
+
+	Context("when sending events with a request id", func() {
+		BeforeEach(func() {
+			ctx := WithRequestID(context.Background(), "some-request-id")
+			client.SendEventsContext(ctx, prometheusEvent, moogsoftServer.GetToken())
+		})
+
+		It("Should tag the logs with the request id", func() {
+			Expect(logs.String()).Should(ContainSubstring(`"msg":"Unsopported service: unknown","request_id":"some-request-id"`))
+			Expect(logs.String()).Should(ContainSubstring(`"msg":"Sent events to moogsoft","request_id":"some-request-id"`))
+		})
+
+		It("Should send the request id to moogsoft", func() {
+			Expect(moogsoftServer.ReceivedRequestIDs).Should(Equal([]string{"some-request-id"}))
+		})
+
+		It("Should redact the configured keys from the logged payload", func() {
+			Expect(logs.String()).Should(ContainSubstring(`"msg":"Received payload"`))
+			Expect(logs.String()).Should(ContainSubstring(`"password":"[REDACTED]"`))
+			Expect(logs.String()).ShouldNot(ContainSubstring("s3cr3t"))
+		})
+	})
+})
@@ -0,0 +1,228 @@
+package client
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// LookupTable enriches the moogsoft events with the row of a CSV or YAML file
+// matching the values of the Keys labels of the alert, e.g. the CMDB owner of
+// a bosh_deployment. Every column but the keys sets the event field with the
+// same json name, like aonSNOWGroupName or agent_location. The file is read
+// again whenever it is modified.
+type LookupTable struct {
+	Name string `yaml:"name"`
+	// Path is a CSV file with a header row, or a YAML list of rows.
+	Path string   `yaml:"path"`
+	Keys []string `yaml:"keys"`
+	// Override replaces the event fields already set, by default only the
+	// empty ones are filled.
+	Override bool `yaml:"override"`
+	// OnMiss is ignore (default), warn, default to set the Default fields, or
+	// drop to not send the event.
+	OnMiss  string            `yaml:"on_miss"`
+	Default map[string]string `yaml:"default"`
+
+	mu      sync.Mutex
+	modTime time.Time
+	rows    map[string]map[string]string
+}
+
+// Validate checks the table and loads its file.
+func (t *LookupTable) Validate() error {
+	if t.Name == "" || t.Path == "" || len(t.Keys) == 0 {
+		return fmt.Errorf("Lookup table %q requires a name, a path and keys", t.Name)
+	}
+
+	switch t.OnMiss {
+	case "", "ignore", "warn", "drop":
+	case "default":
+		if err := setEventFields(&MoogsoftEvent{}, t.Default, true); err != nil {
+			return fmt.Errorf("Lookup table %s: %s", t.Name, err.Error())
+		}
+	default:
+		return fmt.Errorf("Lookup table %s: invalid on_miss %q", t.Name, t.OnMiss)
+	}
+
+	_, err := t.load()
+	return err
+}
+
+// load returns the rows of the table, reading the file again when it was
+// modified. When the file can not be read the previous rows are kept.
+func (t *LookupTable) load() (map[string]map[string]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info, err := os.Stat(t.Path)
+	if err != nil {
+		return t.rows, err
+	}
+
+	if info.ModTime().Equal(t.modTime) {
+		return t.rows, nil
+	}
+
+	content, err := ioutil.ReadFile(t.Path)
+	if err != nil {
+		return t.rows, err
+	}
+
+	var records []map[string]string
+	switch strings.ToLower(filepath.Ext(t.Path)) {
+	case ".csv":
+		records, err = parseCSVRows(content)
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(content, &records)
+	default:
+		err = fmt.Errorf("unsupported file type, expected .csv, .yml or .yaml")
+	}
+	if err != nil {
+		return t.rows, fmt.Errorf("Lookup table %s: %s", t.Name, err.Error())
+	}
+
+	rows := map[string]map[string]string{}
+	for _, record := range records {
+		fields := map[string]string{}
+		for column, value := range record {
+			fields[column] = value
+		}
+		for _, key := range t.Keys {
+			delete(fields, key)
+		}
+
+		if err := setEventFields(&MoogsoftEvent{}, fields, true); err != nil {
+			return t.rows, fmt.Errorf("Lookup table %s: %s", t.Name, err.Error())
+		}
+
+		rows[lookupKey(t.Keys, record)] = fields
+	}
+
+	t.rows = rows
+	t.modTime = info.ModTime()
+
+	return t.rows, nil
+}
+
+// enrich sets the fields of the row matching the alert on the event,
+// returning false when the event must be dropped.
+func (t *LookupTable) enrich(event *MoogsoftEvent, alert PrometheusAlert) (bool, error) {
+	rows, err := t.load()
+
+	fields, ok := rows[lookupKey(t.Keys, alert.Labels)]
+	if !ok {
+		switch t.OnMiss {
+		case "warn":
+			return true, fmt.Errorf("No row in lookup table %s for %s", t.Name, lookupKey(t.Keys, alert.Labels))
+		case "drop":
+			return false, err
+		case "default":
+			fields = t.Default
+		default:
+			return true, err
+		}
+	}
+
+	setEventFields(event, fields, t.Override)
+
+	return true, err
+}
+
+func lookupKey(keys []string, values map[string]string) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s=%q", key, values[key])
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func parseCSVRows(content []byte) ([]map[string]string, error) {
+	lines, err := csv.NewReader(strings.NewReader(string(content))).ReadAll()
+	if err != nil || len(lines) == 0 {
+		return nil, err
+	}
+
+	header := lines[0]
+	rows := make([]map[string]string, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		row := map[string]string{}
+		for i, column := range header {
+			row[strings.TrimSpace(column)] = strings.TrimSpace(line[i])
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// setEventFields sets the string fields of the event named by their json
+// name. Fields already set are only replaced when override is true.
+func setEventFields(event *MoogsoftEvent, fields map[string]string, override bool) error {
+	for name, value := range fields {
+		if err := setEventField(event, name, value, override); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setEventField(event *MoogsoftEvent, name string, value string, override bool) error {
+	// The signature identifies the alert in moogsoft and in the registry.
+	if name == "signature" || name == "external_id" {
+		return fmt.Errorf("Event field %s can not be set", name)
+	}
+
+	v := reflect.ValueOf(event).Elem()
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if strings.Split(field.Tag.Get("json"), ",")[0] != name {
+			continue
+		}
+
+		if field.Type.Kind() != reflect.String {
+			return fmt.Errorf("Event field %s can not be set", name)
+		}
+
+		if override || v.Field(i).String() == "" {
+			v.Field(i).SetString(value)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("Unknown event field: %s", name)
+}
+
+// enrich applies the lookup tables and then the HTTP enrichments to the
+// event, returning false when a table drops it.
+func (c *Client) enrich(ctx context.Context, event *MoogsoftEvent, alert PrometheusAlert) bool {
+	for _, table := range c.Lookups {
+		keep, err := table.enrich(event, alert)
+		if err != nil {
+			loggerFor(ctx).Warn("Lookup failed", "lookup_table", table.Name, "signature", event.Signature, "error", err.Error())
+		}
+		if !keep {
+			return false
+		}
+	}
+
+	for _, enrichment := range c.Enrichments {
+		if err := enrichment.enrich(ctx, event, alert); err != nil {
+			loggerFor(ctx).Warn("HTTP enrichment failed, sending the event unenriched", "http_enrichment", enrichment.Name, "signature", event.Signature, "error", err.Error())
+		}
+	}
+
+	return true
+}
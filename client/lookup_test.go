@@ -0,0 +1,150 @@
+package client_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("LookupTable", func() {
+	var client *Client
+	var moogsoftServer FakeMoogsoftServer
+	var dir string
+	var table *LookupTable
+
+	alert := func(deployment string) PrometheusAlert {
+		return PrometheusAlert{
+			Status:   "firing",
+			Labels:   map[string]string{"alertname": "Down", "environment": "prod", "bosh_deployment": deployment, "service": "cf", "severity": "warning"},
+			StartsAt: "2018-10-23T16:44:39.901211833Z",
+		}
+	}
+
+	writeTable := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, []byte(content), 0600)).Should(Succeed())
+		return path
+	}
+
+	send := func(alerts ...PrometheusAlert) {
+		_, err := client.SendAlerts(context.Background(), alerts, moogsoftServer.GetToken())
+		Expect(err).ShouldNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "lookup")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		moogsoftServer.Start()
+
+		table = &LookupTable{
+			Name: "cmdb",
+			Path: writeTable("cmdb.csv", "environment,bosh_deployment,aonSNOWGroupName,agent_location\nprod,cf,PCF-Ops,Frankfurt\nprod,concourse,CI-Team,Dublin\n"),
+			Keys: []string{"environment", "bosh_deployment"},
+		}
+
+		client = &Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+			Lookups:        []*LookupTable{table},
+		}
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+		os.RemoveAll(dir)
+	})
+
+	It("Should set the event fields of the matching CSV row", func() {
+		Expect(table.Validate()).Should(Succeed())
+
+		send(alert("cf"), alert("concourse"))
+
+		Expect(moogsoftServer.ReceivedEvents[0].AonSNOWGroupName).Should(Equal("PCF-Ops"))
+		Expect(moogsoftServer.ReceivedEvents[0].AgentLocation).Should(Equal("Frankfurt"))
+		Expect(moogsoftServer.ReceivedEvents[1].AonSNOWGroupName).Should(Equal("CI-Team"))
+	})
+
+	It("Should read YAML tables", func() {
+		table.Path = writeTable("cmdb.yml", "- environment: prod\n  bosh_deployment: cf\n  aonXMattersGroupName: PCF-Oncall\n")
+		table.Override = true
+		client.XMattersGroupName = "default-group"
+		Expect(table.Validate()).Should(Succeed())
+
+		send(alert("cf"))
+
+		Expect(moogsoftServer.ReceivedEvents[0].AonXMattersGroupName).Should(Equal("PCF-Oncall"))
+	})
+
+	It("Should only fill empty fields unless overriding", func() {
+		table.Path = writeTable("cmdb.yml", "- environment: prod\n  bosh_deployment: cf\n  aonXMattersGroupName: PCF-Oncall\n")
+		client.XMattersGroupName = "default-group"
+		Expect(table.Validate()).Should(Succeed())
+
+		send(alert("cf"))
+
+		Expect(moogsoftServer.ReceivedEvents[0].AonXMattersGroupName).Should(Equal("default-group"))
+	})
+
+	It("Should read the file again when it changes", func() {
+		Expect(table.Validate()).Should(Succeed())
+
+		writeTable("cmdb.csv", "environment,bosh_deployment,aonSNOWGroupName\nprod,cf,New-Owner\n")
+		later := time.Now().Add(time.Minute)
+		Expect(os.Chtimes(table.Path, later, later)).Should(Succeed())
+
+		send(alert("cf"))
+
+		Expect(moogsoftServer.ReceivedEvents[0].AonSNOWGroupName).Should(Equal("New-Owner"))
+	})
+
+	Context("when no row matches", func() {
+		It("Should send the event unchanged by default", func() {
+			Expect(table.Validate()).Should(Succeed())
+
+			send(alert("redis"))
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+			Expect(moogsoftServer.ReceivedEvents[0].AonSNOWGroupName).Should(BeEmpty())
+		})
+
+		It("Should set the default fields", func() {
+			table.OnMiss = "default"
+			table.Default = map[string]string{"aonSNOWGroupName": "Unowned"}
+			Expect(table.Validate()).Should(Succeed())
+
+			send(alert("redis"))
+
+			Expect(moogsoftServer.ReceivedEvents[0].AonSNOWGroupName).Should(Equal("Unowned"))
+		})
+
+		It("Should drop the event", func() {
+			table.OnMiss = "drop"
+			Expect(table.Validate()).Should(Succeed())
+
+			send(alert("redis"), alert("cf"))
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+			Expect(moogsoftServer.ReceivedEvents[0].AonSNOWGroupName).Should(Equal("PCF-Ops"))
+		})
+	})
+
+	It("Should reject tables setting unknown or protected fields", func() {
+		table.Path = writeTable("bad.csv", "bosh_deployment,owner\ncf,PCF-Ops\n")
+		Expect(table.Validate()).Should(MatchError(ContainSubstring("Unknown event field: owner")))
+
+		table.Path = writeTable("bad.csv", "bosh_deployment,signature\ncf,PCF-Ops\n")
+		Expect(table.Validate()).ShouldNot(Succeed())
+
+		table.Path = writeTable("bad.csv", "bosh_deployment,severity\ncf,5\n")
+		Expect(table.Validate()).ShouldNot(Succeed())
+	})
+})
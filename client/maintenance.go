@@ -0,0 +1,284 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrConfiguredWindow is returned when changing through the API a window set
+// in the config file, which would come back on restart.
+var ErrConfiguredWindow = errors.New("Maintenance window set in the config file")
+
+// MaintenanceWindow changes what is sent to moogsoft for the alerts matching
+// its labels while it is active, either between StartsAt and EndsAt or for
+// Duration after every time Schedule fires. A window without matchers needs
+// MatchAll, as it matches every alert.
+type MaintenanceWindow struct {
+	Name     string            `yaml:"name" json:"name"`
+	Matchers map[string]string `yaml:"matchers" json:"matchers"`
+	MatchAll bool              `yaml:"match_all" json:"match_all,omitempty"`
+	StartsAt time.Time         `yaml:"starts_at" json:"starts_at,omitempty"`
+	EndsAt   time.Time         `yaml:"ends_at" json:"ends_at,omitempty"`
+	// Schedule is a cron expression evaluated in Timezone, UTC by default.
+	Schedule string `yaml:"schedule" json:"schedule,omitempty"`
+	Duration string `yaml:"duration" json:"duration,omitempty"`
+	Timezone string `yaml:"timezone" json:"timezone,omitempty"`
+	// Action is drop, downgrade to Severity, or tag to prefix the
+	// description.
+	Action   string `yaml:"action" json:"action"`
+	Severity string `yaml:"severity" json:"severity,omitempty"`
+
+	schedule *cronSchedule
+	duration time.Duration
+	location *time.Location
+	severity Severity
+}
+
+// Validate checks the window and parses its schedule.
+func (w *MaintenanceWindow) Validate() error {
+	if w.Name == "" {
+		return errors.New("Maintenance window without name")
+	}
+
+	if len(w.Matchers) == 0 && !w.MatchAll {
+		return fmt.Errorf("Maintenance window %s: matchers are required, set match_all to match every alert", w.Name)
+	}
+
+	var err error
+
+	switch {
+	case w.Schedule != "":
+		if w.schedule, err = parseCron(w.Schedule); err != nil {
+			return fmt.Errorf("Maintenance window %s: %s", w.Name, err.Error())
+		}
+		if w.duration, err = time.ParseDuration(w.Duration); err != nil || w.duration <= 0 {
+			return fmt.Errorf("Maintenance window %s: invalid duration %q", w.Name, w.Duration)
+		}
+		if w.location, err = time.LoadLocation(w.Timezone); err != nil {
+			return fmt.Errorf("Maintenance window %s: %s", w.Name, err.Error())
+		}
+	case w.StartsAt.IsZero() || w.EndsAt.IsZero():
+		return fmt.Errorf("Maintenance window %s: either a schedule or starts_at and ends_at are required", w.Name)
+	case !w.EndsAt.After(w.StartsAt):
+		return fmt.Errorf("Maintenance window %s: ends_at must be after starts_at", w.Name)
+	}
+
+	switch w.Action {
+	case "drop", "tag":
+	case "downgrade":
+		if w.severity, err = ParseSeverity(w.Severity); err != nil {
+			return fmt.Errorf("Maintenance window %s: %s", w.Name, err.Error())
+		}
+	default:
+		return fmt.Errorf("Maintenance window %s: invalid action %q", w.Name, w.Action)
+	}
+
+	return nil
+}
+
+// Active reports whether the window is active at now.
+func (w *MaintenanceWindow) Active(now time.Time) bool {
+	if w.schedule != nil {
+		return w.schedule.firedWithin(now.In(w.location), w.duration)
+	}
+
+	return !now.Before(w.StartsAt) && now.Before(w.EndsAt)
+}
+
+func (w *MaintenanceWindow) matches(alert PrometheusAlert) bool {
+	for name, value := range w.Matchers {
+		if alert.Labels[name] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// apply changes the event as the window action says, returning false when the
+// event is dropped. Resolutions are always sent, so alerts opened before the
+// window do not stay open.
+func (w *MaintenanceWindow) apply(event MoogsoftEvent, alert PrometheusAlert) (MoogsoftEvent, bool) {
+	if alert.Status == "resolved" || event.Severity == CLEAR {
+		return event, true
+	}
+
+	switch w.Action {
+	case "drop":
+		return event, false
+	case "downgrade":
+		if w.severity < event.Severity {
+			event.Severity = w.severity
+		}
+	case "tag":
+		event.Description = fmt.Sprintf("[In maintenance: %s] %s", w.Name, event.Description)
+	}
+
+	return event, true
+}
+
+// MaintenanceSchedule holds the maintenance windows, from the config file or
+// the API. When it has a path, the windows added through the API are saved to
+// that file after every change so they survive restarts, the ones of the
+// config file are set again on every start instead.
+type MaintenanceSchedule struct {
+	path string
+
+	mu         sync.Mutex
+	windows    map[string]MaintenanceWindow
+	configured map[string]MaintenanceWindow
+}
+
+func NewMaintenanceSchedule() *MaintenanceSchedule {
+	return &MaintenanceSchedule{
+		windows:    map[string]MaintenanceWindow{},
+		configured: map[string]MaintenanceWindow{},
+	}
+}
+
+// OpenMaintenanceSchedule returns a schedule persisted in the file at path,
+// loading the windows saved by a previous run.
+func OpenMaintenanceSchedule(path string) (*MaintenanceSchedule, error) {
+	s := NewMaintenanceSchedule()
+	s.path = path
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) > 0 {
+		var windows []MaintenanceWindow
+		if err := json.Unmarshal(content, &windows); err != nil {
+			return nil, err
+		}
+
+		for _, window := range windows {
+			if err := window.Validate(); err != nil {
+				return nil, err
+			}
+			s.windows[window.Name] = window
+		}
+	}
+
+	return s, nil
+}
+
+// AddConfigured validates the window of the config file and adds it. It is
+// not saved, and replaces the saved window with the same name, so the windows
+// removed from the config file do not come back.
+func (s *MaintenanceSchedule) AddConfigured(window MaintenanceWindow) error {
+	if err := window.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.configured[window.Name] = window
+
+	if _, ok := s.windows[window.Name]; !ok {
+		return nil
+	}
+	delete(s.windows, window.Name)
+
+	return s.save()
+}
+
+// Add validates the window and adds it, replacing the window with the same
+// name unless it is set in the config file.
+func (s *MaintenanceSchedule) Add(window MaintenanceWindow) error {
+	if err := window.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.configured[window.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrConfiguredWindow, window.Name)
+	}
+
+	s.windows[window.Name] = window
+
+	return s.save()
+}
+
+// Remove deletes the window named name, returning false if there is none.
+func (s *MaintenanceSchedule) Remove(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.configured[name]; ok {
+		return false, fmt.Errorf("%w: %s", ErrConfiguredWindow, name)
+	}
+
+	if _, ok := s.windows[name]; !ok {
+		return false, nil
+	}
+	delete(s.windows, name)
+
+	return true, s.save()
+}
+
+// List returns the windows sorted by name.
+func (s *MaintenanceSchedule) List() []MaintenanceWindow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	windows := map[string]MaintenanceWindow{}
+	for name, window := range s.windows {
+		windows[name] = window
+	}
+	for name, window := range s.configured {
+		windows[name] = window
+	}
+
+	return sortedWindows(windows)
+}
+
+func sortedWindows(windowsByName map[string]MaintenanceWindow) []MaintenanceWindow {
+	windows := []MaintenanceWindow{}
+	for _, window := range windowsByName {
+		windows = append(windows, window)
+	}
+
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].Name < windows[j].Name
+	})
+
+	return windows
+}
+
+// save writes the windows added through the API to the schedule file.
+func (s *MaintenanceSchedule) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	return saveJSON(s.path, sortedWindows(s.windows))
+}
+
+// windowFor returns the first active window, by name, matching the alert.
+func (s *MaintenanceSchedule) windowFor(alert PrometheusAlert, now time.Time) (MaintenanceWindow, bool) {
+	if s == nil {
+		return MaintenanceWindow{}, false
+	}
+
+	for _, window := range s.List() {
+		if window.Active(now) && window.matches(alert) {
+			return window, true
+		}
+	}
+
+	return MaintenanceWindow{}, false
+}
@@ -0,0 +1,238 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("MaintenanceSchedule", func() {
+	var client *Client
+	var moogsoftServer FakeMoogsoftServer
+
+	alert := func(status string, deployment string) PrometheusAlert {
+		return PrometheusAlert{
+			Status:      status,
+			Labels:      map[string]string{"alertname": "PrometheusScrapeError", "bosh_deployment": deployment, "job": "concourse", "service": "prometheus", "severity": "critical"},
+			Annotations: map[string]string{"description": "scrape failing"},
+			StartsAt:    "2018-10-23T16:44:39.901211833Z",
+		}
+	}
+
+	window := func(action string) MaintenanceWindow {
+		return MaintenanceWindow{
+			Name:     "concourse-upgrade",
+			Matchers: map[string]string{"bosh_deployment": "concourse"},
+			StartsAt: time.Now().Add(-time.Hour),
+			EndsAt:   time.Now().Add(time.Hour),
+			Action:   action,
+			Severity: "MINOR",
+		}
+	}
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+
+		client = &Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+			Maintenance:    NewMaintenanceSchedule(),
+		}
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+	})
+
+	It("Should drop the firing alerts matching a drop window", func() {
+		Expect(client.Maintenance.Add(window("drop"))).Should(Succeed())
+
+		_, err := client.SendAlerts(context.Background(), []PrometheusAlert{alert("firing", "concourse"), alert("firing", "cf")}, moogsoftServer.GetToken())
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+		Expect(moogsoftServer.ReceivedEvents[0].Signature).Should(Equal("PrometheusScrapeError::cf::concourse"))
+	})
+
+	It("Should still send the resolved alerts matching a drop window", func() {
+		Expect(client.Maintenance.Add(window("drop"))).Should(Succeed())
+
+		_, err := client.SendAlerts(context.Background(), []PrometheusAlert{alert("resolved", "concourse")}, moogsoftServer.GetToken())
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+		Expect(moogsoftServer.ReceivedEvents[0].Severity).Should(Equal(CLEAR))
+	})
+
+	It("Should downgrade the alerts matching a downgrade window", func() {
+		Expect(client.Maintenance.Add(window("downgrade"))).Should(Succeed())
+
+		client.SendAlerts(context.Background(), []PrometheusAlert{alert("firing", "concourse")}, moogsoftServer.GetToken())
+
+		Expect(moogsoftServer.ReceivedEvents[0].Severity).Should(Equal(MINOR))
+	})
+
+	It("Should tag the alerts matching a tag window", func() {
+		Expect(client.Maintenance.Add(window("tag"))).Should(Succeed())
+
+		client.SendAlerts(context.Background(), []PrometheusAlert{alert("firing", "concourse")}, moogsoftServer.GetToken())
+
+		Expect(moogsoftServer.ReceivedEvents[0].Description).Should(Equal("[In maintenance: concourse-upgrade] scrape failing"))
+		Expect(moogsoftServer.ReceivedEvents[0].Severity).Should(Equal(CRITICAL))
+	})
+
+	It("Should ignore windows that ended", func() {
+		ended := window("drop")
+		ended.StartsAt, ended.EndsAt = time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour)
+		Expect(client.Maintenance.Add(ended)).Should(Succeed())
+
+		client.SendAlerts(context.Background(), []PrometheusAlert{alert("firing", "concourse")}, moogsoftServer.GetToken())
+
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+	})
+
+	It("Should list and remove windows", func() {
+		Expect(client.Maintenance.Add(window("drop"))).Should(Succeed())
+		Expect(client.Maintenance.List()).Should(HaveLen(1))
+
+		Expect(client.Maintenance.Remove("concourse-upgrade")).Should(BeTrue())
+		Expect(client.Maintenance.Remove("concourse-upgrade")).Should(BeFalse())
+		Expect(client.Maintenance.List()).Should(BeEmpty())
+	})
+
+	It("Should keep the windows when reopened from its file", func() {
+		dir, err := ioutil.TempDir("", "maintenance")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		schedule, err := OpenMaintenanceSchedule(filepath.Join(dir, "maintenance.json"))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(schedule.Add(window("downgrade"))).Should(Succeed())
+
+		client.Maintenance, err = OpenMaintenanceSchedule(filepath.Join(dir, "maintenance.json"))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(client.Maintenance.List()).Should(HaveLen(1))
+
+		client.SendAlerts(context.Background(), []PrometheusAlert{alert("firing", "concourse")}, moogsoftServer.GetToken())
+
+		Expect(moogsoftServer.ReceivedEvents[0].Severity).Should(Equal(MINOR))
+	})
+
+	Context("when the windows are set in the config file", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "maintenance")
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() { os.RemoveAll(dir) })
+
+		It("Should not save them", func() {
+			schedule, err := OpenMaintenanceSchedule(filepath.Join(dir, "maintenance.json"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(schedule.AddConfigured(window("drop"))).Should(Succeed())
+			Expect(schedule.List()).Should(HaveLen(1))
+
+			schedule, err = OpenMaintenanceSchedule(filepath.Join(dir, "maintenance.json"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(schedule.List()).Should(BeEmpty())
+		})
+
+		It("Should replace the saved window with the same name", func() {
+			schedule, err := OpenMaintenanceSchedule(filepath.Join(dir, "maintenance.json"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(schedule.Add(window("downgrade"))).Should(Succeed())
+
+			schedule, err = OpenMaintenanceSchedule(filepath.Join(dir, "maintenance.json"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(schedule.AddConfigured(window("drop"))).Should(Succeed())
+			Expect(schedule.List()).Should(HaveLen(1))
+			Expect(schedule.List()[0].Action).Should(Equal("drop"))
+
+			schedule, err = OpenMaintenanceSchedule(filepath.Join(dir, "maintenance.json"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(schedule.List()).Should(BeEmpty())
+		})
+
+		It("Should not change them through the API", func() {
+			Expect(client.Maintenance.AddConfigured(window("drop"))).Should(Succeed())
+
+			err := client.Maintenance.Add(window("tag"))
+			Expect(errors.Is(err, ErrConfiguredWindow)).Should(BeTrue())
+
+			removed, err := client.Maintenance.Remove("concourse-upgrade")
+			Expect(removed).Should(BeFalse())
+			Expect(errors.Is(err, ErrConfiguredWindow)).Should(BeTrue())
+			Expect(client.Maintenance.List()).Should(HaveLen(1))
+			Expect(client.Maintenance.List()[0].Action).Should(Equal("drop"))
+		})
+	})
+
+	It("Should only match every alert when asked to", func() {
+		everything := window("drop")
+		everything.Matchers = nil
+		Expect(client.Maintenance.Add(everything)).Should(MatchError(ContainSubstring("matchers are required")))
+
+		everything.MatchAll = true
+		Expect(client.Maintenance.Add(everything)).Should(Succeed())
+
+		client.SendAlerts(context.Background(), []PrometheusAlert{alert("firing", "concourse"), alert("firing", "cf")}, moogsoftServer.GetToken())
+
+		Expect(moogsoftServer.ReceivedEvents).Should(BeEmpty())
+	})
+
+	Describe("MaintenanceWindow", func() {
+		sundayNight := MaintenanceWindow{Name: "patching", MatchAll: true, Schedule: "0 22 * * 0", Duration: "3h", Action: "drop"}
+
+		BeforeEach(func() {
+			Expect(sundayNight.Validate()).Should(Succeed())
+		})
+
+		It("Should be active for the duration after the schedule fires", func() {
+			Expect(sundayNight.Active(time.Date(2018, 10, 21, 22, 0, 0, 0, time.UTC))).Should(BeTrue())
+			Expect(sundayNight.Active(time.Date(2018, 10, 22, 0, 59, 0, 0, time.UTC))).Should(BeTrue())
+		})
+
+		It("Should be inactive outside the schedule", func() {
+			Expect(sundayNight.Active(time.Date(2018, 10, 21, 21, 59, 0, 0, time.UTC))).Should(BeFalse())
+			Expect(sundayNight.Active(time.Date(2018, 10, 22, 1, 0, 0, 0, time.UTC))).Should(BeFalse())
+			Expect(sundayNight.Active(time.Date(2018, 10, 23, 22, 30, 0, 0, time.UTC))).Should(BeFalse())
+		})
+
+		It("Should evaluate the schedule in its timezone", func() {
+			berlin := MaintenanceWindow{Name: "patching", MatchAll: true, Schedule: "0-30/15 9-17 1,15 * *", Duration: "10m", Timezone: "Europe/Berlin", Action: "tag"}
+			Expect(berlin.Validate()).Should(Succeed())
+
+			Expect(berlin.Active(time.Date(2018, 10, 15, 7, 35, 0, 0, time.UTC))).Should(BeTrue())
+			Expect(berlin.Active(time.Date(2018, 10, 15, 9, 35, 0, 0, time.UTC))).Should(BeTrue())
+			Expect(berlin.Active(time.Date(2018, 10, 15, 7, 45, 0, 0, time.UTC))).Should(BeFalse())
+		})
+
+		It("Should find the last run of rare schedules", func() {
+			newYear := MaintenanceWindow{Name: "freeze", MatchAll: true, Schedule: "0 0 1 1 *", Duration: "720h", Action: "drop"}
+			Expect(newYear.Validate()).Should(Succeed())
+
+			Expect(newYear.Active(time.Date(2019, 1, 30, 23, 59, 0, 0, time.UTC))).Should(BeTrue())
+			Expect(newYear.Active(time.Date(2019, 1, 31, 0, 0, 0, 0, time.UTC))).Should(BeFalse())
+			Expect(newYear.Active(time.Date(2018, 12, 31, 23, 59, 0, 0, time.UTC))).Should(BeFalse())
+		})
+
+		It("Should reject invalid windows", func() {
+			Expect((&MaintenanceWindow{Name: "bad", MatchAll: true, Schedule: "0 25 * * *", Duration: "1h", Action: "drop"}).Validate()).ShouldNot(Succeed())
+			Expect((&MaintenanceWindow{Name: "bad", MatchAll: true, Schedule: "0 22 * * 0", Action: "drop"}).Validate()).ShouldNot(Succeed())
+			Expect((&MaintenanceWindow{Name: "bad", MatchAll: true, StartsAt: time.Now(), Action: "drop"}).Validate()).ShouldNot(Succeed())
+			Expect((&MaintenanceWindow{Name: "bad", MatchAll: true, Schedule: "0 22 * * 0", Duration: "1h", Action: "downgrade", Severity: "LOW"}).Validate()).ShouldNot(Succeed())
+			Expect((&MaintenanceWindow{Name: "bad", MatchAll: true, Schedule: "0 22 * * 0", Duration: "1h", Action: "mute"}).Validate()).ShouldNot(Succeed())
+		})
+	})
+})
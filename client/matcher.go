@@ -0,0 +1,156 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type MatchType string
+
+const (
+	MatchEqual    MatchType = "="
+	MatchNotEqual MatchType = "!="
+	MatchRegex    MatchType = "=~"
+	MatchNotRegex MatchType = "!~"
+)
+
+// Matcher is a label matcher in the alertmanager syntax, e.g.
+// severity!="info" or environment=~"prod|staging".
+type Matcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+
+	re *regexp.Regexp
+}
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseMatcher parses a matcher, its value may be double quoted.
+func ParseMatcher(expression string) (Matcher, error) {
+	var m Matcher
+
+	i := strings.IndexAny(expression, "=!")
+	if i == -1 {
+		return m, fmt.Errorf("Invalid matcher %q: missing operator", expression)
+	}
+
+	m.Name = strings.TrimSpace(expression[:i])
+	if !labelNameRegexp.MatchString(m.Name) {
+		return m, fmt.Errorf("Invalid matcher %q: invalid label name", expression)
+	}
+
+	rest := expression[i:]
+	for _, matchType := range []MatchType{MatchRegex, MatchNotRegex, MatchNotEqual, MatchEqual} {
+		if strings.HasPrefix(rest, string(matchType)) {
+			m.Type = matchType
+			rest = rest[len(matchType):]
+			break
+		}
+	}
+	if m.Type == "" {
+		return m, fmt.Errorf("Invalid matcher %q: unknown operator", expression)
+	}
+
+	m.Value = strings.TrimSpace(rest)
+	if strings.HasPrefix(m.Value, `"`) {
+		value, err := strconv.Unquote(m.Value)
+		if err != nil {
+			return m, fmt.Errorf("Invalid matcher %q: %s", expression, err.Error())
+		}
+		m.Value = value
+	}
+
+	if m.Type == MatchRegex || m.Type == MatchNotRegex {
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return m, fmt.Errorf("Invalid matcher %q: %s", expression, err.Error())
+		}
+		m.re = re
+	}
+
+	return m, nil
+}
+
+// Matches reports whether the labels match, a missing label matches as an
+// empty value.
+func (m Matcher) Matches(labels map[string]string) bool {
+	value := labels[m.Name]
+
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegex:
+		return m.re.MatchString(value)
+	case MatchNotRegex:
+		return !m.re.MatchString(value)
+	default:
+		return false
+	}
+}
+
+func (m Matcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Name, m.Type, m.Value)
+}
+
+// LabelFilter keeps the alerts matching every Include matcher and none of the
+// Exclude matchers.
+type LabelFilter struct {
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+
+	include []Matcher
+	exclude []Matcher
+}
+
+// Validate parses the matchers of the filter.
+func (f *LabelFilter) Validate() error {
+	var err error
+
+	if f.include, err = parseMatchers(f.Include); err != nil {
+		return err
+	}
+	f.exclude, err = parseMatchers(f.Exclude)
+
+	return err
+}
+
+// Accepts reports whether the alert labels pass the filter, a nil filter
+// accepts every alert.
+func (f *LabelFilter) Accepts(labels map[string]string) bool {
+	if f == nil {
+		return true
+	}
+
+	for _, m := range f.include {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+
+	for _, m := range f.exclude {
+		if m.Matches(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func parseMatchers(expressions []string) ([]Matcher, error) {
+	matchers := make([]Matcher, 0, len(expressions))
+
+	for _, expression := range expressions {
+		m, err := ParseMatcher(expression)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+
+	return matchers, nil
+}
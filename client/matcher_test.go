@@ -0,0 +1,104 @@
+package client_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("Matcher", func() {
+	labels := map[string]string{"environment": "prod", "severity": "warning"}
+
+	DescribeTable("Should match labels with the alertmanager syntax",
+		func(expression string, matches bool) {
+			m, err := ParseMatcher(expression)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(m.Matches(labels)).Should(Equal(matches))
+		},
+		Entry("equal", `environment="prod"`, true),
+		Entry("unquoted equal", `environment=prod`, true),
+		Entry("not equal", `environment!="prod"`, false),
+		Entry("regexp", `environment=~"prod|staging"`, true),
+		Entry("anchored regexp", `environment=~"pro"`, false),
+		Entry("not regexp", `severity!~"info|none"`, true),
+		Entry("missing label as empty", `team=""`, true),
+	)
+
+	It("Should reject invalid matchers", func() {
+		for _, expression := range []string{`environment`, `1env="prod"`, `env=~"("`, `env="prod`} {
+			_, err := ParseMatcher(expression)
+			Expect(err).Should(HaveOccurred(), expression)
+		}
+	})
+})
+
+var _ = Describe("LabelFilter", func() {
+	var client *Client
+	var moogsoftServer FakeMoogsoftServer
+
+	alert := func(tenant string, severity string, environment string) PrometheusAlert {
+		return PrometheusAlert{
+			Status:   "firing",
+			Labels:   map[string]string{"alertname": "Down", "environment": environment, "bosh_deployment": tenant, "service": "cf", "severity": severity, "tenant": tenant},
+			StartsAt: "2018-10-23T16:44:39.901211833Z",
+		}
+	}
+
+	filter := func(include []string, exclude []string) *LabelFilter {
+		f := &LabelFilter{Include: include, Exclude: exclude}
+		Expect(f.Validate()).Should(Succeed())
+		return f
+	}
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+
+		client = &Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+		}
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+	})
+
+	It("Should keep out the alerts not passing every filter", func() {
+		client.Filters = []*LabelFilter{
+			filter(nil, []string{`environment="test"`}),
+			filter([]string{`severity=~"warning|critical"`}, nil),
+			nil,
+		}
+
+		_, err := client.SendAlerts(context.Background(), []PrometheusAlert{
+			alert("a", "warning", "prod"),
+			alert("b", "warning", "test"),
+			alert("c", "info", "prod"),
+		}, moogsoftServer.GetToken())
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+		Expect(moogsoftServer.ReceivedEvents[0].Signature).Should(Equal("Down::prod::a"))
+	})
+
+	It("Should apply the filter of the alert tenant", func() {
+		client.TenantLabel = "tenant"
+		client.TenantFilters = map[string]*LabelFilter{
+			"a": filter(nil, []string{`severity="warning"`}),
+		}
+
+		client.SendAlerts(context.Background(), []PrometheusAlert{
+			alert("a", "warning", "prod"),
+			alert("a", "critical", "prod"),
+			alert("b", "warning", "prod"),
+		}, moogsoftServer.GetToken())
+
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(2))
+		Expect(moogsoftServer.ReceivedEvents[0].Severity).Should(Equal(CRITICAL))
+		Expect(moogsoftServer.ReceivedEvents[1].Signature).Should(Equal("Down::prod::b"))
+	})
+})
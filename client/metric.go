@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricConfig sets where the AonMetricValue of the events comes from when
+// the alert carries no value itself, like the grafana ones do.
+type MetricConfig struct {
+	// ValueAnnotation is the annotation holding the value, e.g. one set to
+	// {{ $value }} in the alerting rule.
+	ValueAnnotation string `yaml:"value_annotation"`
+	// PrometheusURL is queried with the alert expression at its start time
+	// when no value was found. After a failure the queries are skipped for
+	// FailureBackoff, so an outage does not delay every event by the timeout.
+	PrometheusURL  string        `yaml:"prometheus_url"`
+	QueryTimeout   time.Duration `yaml:"query_timeout"`
+	FailureBackoff time.Duration `yaml:"failure_backoff"`
+
+	HTTPClient *http.Client `yaml:"-"`
+
+	mu      sync.Mutex
+	breaker *CircuitBreaker
+}
+
+// PrometheusSample is a sample of the vector returned by the prometheus
+// /api/v1/query endpoint.
+type PrometheusSample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
+type prometheusQueryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string             `json:"resultType"`
+		Result     []PrometheusSample `json:"result"`
+	} `json:"data"`
+}
+
+// alertExpression returns the g0.expr of the prometheus graph url.
+func alertExpression(generatorURL string) string {
+	u, err := url.Parse(generatorURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Query().Get("g0.expr")
+}
+
+// promQLKeywords are the operators and aggregations that are not metrics even
+// when not followed by a parenthesis.
+var promQLKeywords = map[string]bool{
+	"and": true, "or": true, "unless": true, "bool": true, "offset": true,
+	"sum": true, "min": true, "max": true, "avg": true, "group": true, "stddev": true, "stdvar": true,
+	"count": true, "count_values": true, "bottomk": true, "topk": true, "quantile": true,
+}
+
+// promQLGroupings are followed by a list of labels in parenthesis.
+var promQLGroupings = map[string]bool{
+	"by": true, "without": true, "on": true, "ignoring": true, "group_left": true, "group_right": true,
+}
+
+// metricName returns the first metric selected by the PromQL expression,
+// skipping functions, aggregations, keywords, label matchers, ranges and
+// strings.
+func metricName(expression string) string {
+	skipGroup := false
+
+	for i := 0; i < len(expression); {
+		c := expression[i]
+
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			end := strings.IndexByte(expression[i+1:], c)
+			if end == -1 {
+				return ""
+			}
+			i += end + 2
+
+		case c == '{' || c == '[':
+			closing := map[byte]byte{'{': '}', '[': ']'}[c]
+			end := strings.IndexByte(expression[i:], closing)
+			if end == -1 {
+				return ""
+			}
+			if c == '{' {
+				if name := nameMatcher(expression[i+1 : i+end]); name != "" {
+					return name
+				}
+			}
+			i += end + 1
+
+		case c == '(' && skipGroup:
+			end := strings.IndexByte(expression[i:], ')')
+			if end == -1 {
+				return ""
+			}
+			skipGroup = false
+			i += end + 1
+
+		case c >= '0' && c <= '9' || c == '.':
+			for i < len(expression) && (isIdentifierChar(expression[i]) || expression[i] == '.') {
+				i++
+			}
+
+		case isIdentifierChar(c):
+			start := i
+			for i < len(expression) && isIdentifierChar(expression[i]) {
+				i++
+			}
+			identifier := expression[start:i]
+
+			next := i
+			for next < len(expression) && expression[next] == ' ' {
+				next++
+			}
+
+			switch {
+			case promQLGroupings[strings.ToLower(identifier)]:
+				skipGroup = true
+			case promQLKeywords[strings.ToLower(identifier)]:
+			case next < len(expression) && expression[next] == '(':
+				// function call
+			default:
+				return identifier
+			}
+
+		default:
+			i++
+		}
+	}
+
+	return ""
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == ':' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// nameMatcher returns the metric name of a {__name__="name"} selector.
+func nameMatcher(matchers string) string {
+	for _, matcher := range strings.Split(matchers, ",") {
+		if m, err := ParseMatcher(matcher); err == nil && m.Name == "__name__" && m.Type == MatchEqual {
+			return m.Value
+		}
+	}
+
+	return ""
+}
+
+// valueFor returns the value carried by the alert: the configured annotation,
+// the grafana value when there is a single one, or its value string.
+func (c *MetricConfig) valueFor(alert PrometheusAlert) string {
+	if c != nil && c.ValueAnnotation != "" && alert.Annotations[c.ValueAnnotation] != "" {
+		return alert.Annotations[c.ValueAnnotation]
+	}
+
+	if len(alert.Values) == 1 {
+		for _, value := range alert.Values {
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+
+	return alert.ValueString
+}
+
+// queryValue queries prometheus for the value of the alert expression at the
+// alert start, picking the series whose labels are all alert labels.
+func (c *MetricConfig) queryValue(ctx context.Context, alert PrometheusAlert) (string, error) {
+	expression := alertExpression(alert.GeneratorURL)
+	if c == nil || c.PrometheusURL == "" || expression == "" {
+		return "", nil
+	}
+
+	timeout := c.QueryTimeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	query := url.Values{"query": {expression}}
+	if startsAt, err := time.Parse(time.RFC3339Nano, alert.StartsAt); err == nil {
+		query.Set("time", strconv.FormatFloat(float64(startsAt.UnixNano())/float64(time.Second), 'f', 3, 64))
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(c.PrometheusURL, "/")+"/api/v1/query?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	breaker := c.circuitBreaker()
+	if !breaker.Allow() {
+		return "", fmt.Errorf("Prometheus query skipped after a failure")
+	}
+
+	res, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		breaker.Failure()
+		return "", err
+	}
+	defer res.Body.Close()
+
+	// Errors of the query itself, e.g. an invalid expression, do not mean
+	// prometheus is unavailable.
+	var response prometheusQueryResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		breaker.Failure()
+		return "", fmt.Errorf("Invalid prometheus query response: %s", err.Error())
+	}
+	if res.StatusCode >= 500 {
+		breaker.Failure()
+		return "", fmt.Errorf("Prometheus responded with status code %d: %s", res.StatusCode, response.Error)
+	}
+	breaker.Success()
+
+	if response.Status != "success" {
+		return "", fmt.Errorf("Prometheus query failed: %s", response.Error)
+	}
+
+	for _, sample := range response.Data.Result {
+		if len(sample.Value) == 2 && sampleMatches(sample, alert) {
+			value, _ := sample.Value[1].(string)
+			return value, nil
+		}
+	}
+
+	return "", nil
+}
+
+// circuitBreaker returns the breaker skipping the queries for FailureBackoff
+// after a failure, 30s by default.
+func (c *MetricConfig) circuitBreaker() *CircuitBreaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.breaker == nil {
+		backoff := c.FailureBackoff
+		if backoff <= 0 {
+			backoff = 30 * time.Second
+		}
+		c.breaker = NewCircuitBreaker(1, backoff)
+	}
+
+	return c.breaker
+}
+
+func sampleMatches(sample PrometheusSample, alert PrometheusAlert) bool {
+	for name, value := range sample.Metric {
+		if name != "__name__" && alert.Labels[name] != value {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,131 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("Metric", func() {
+	var client *Client
+	var moogsoftServer FakeMoogsoftServer
+	var prometheusServer FakePrometheusServer
+
+	alert := func(expression string) PrometheusAlert {
+		return PrometheusAlert{
+			Status:       "firing",
+			Labels:       map[string]string{"alertname": "DiskFull", "instance": "10.0.0.1:9100", "service": "probe", "severity": "warning"},
+			Annotations:  map[string]string{},
+			StartsAt:     "2018-10-23T16:44:39Z",
+			GeneratorURL: "https://prometheus.your-domain.com/graph?g0.tab=1&g0.expr=" + url.QueryEscape(expression),
+		}
+	}
+
+	send := func(alert PrometheusAlert) MoogsoftEvent {
+		_, err := client.SendAlerts(context.Background(), []PrometheusAlert{alert}, moogsoftServer.GetToken())
+		Expect(err).ShouldNot(HaveOccurred())
+		return moogsoftServer.ReceivedEvents[0]
+	}
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+		prometheusServer.Start()
+
+		client = &Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+		}
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+		prometheusServer.Stop()
+	})
+
+	DescribeTable("Should take the metric name from the alert expression",
+		func(expression string, name string) {
+			Expect(send(alert(expression)).AonMetricName).Should(Equal(name))
+		},
+		Entry("comparison", "up == 0", "up"),
+		Entry("selector", `node_filesystem_avail_bytes{mountpoint="/", fstype!~"tmpfs|nfs"} < 1e9`, "node_filesystem_avail_bytes"),
+		Entry("functions and ranges", "rate(http_requests_total{code=~\"5..\"}[5m]) > 0.1", "http_requests_total"),
+		Entry("aggregation", "(time() - max by(environment, instance) (firehose_last_envelope_received_timestamp)) > 600", "firehose_last_envelope_received_timestamp"),
+		Entry("aggregation with trailing grouping", "sum without (job) (disk:percent_used) > 90", "disk:percent_used"),
+		Entry("name matcher", `{__name__="probe_success"} == 0`, "probe_success"),
+		Entry("no metric", "vector(1)", ""),
+	)
+
+	It("Should take the metric value from the configured annotation", func() {
+		client.Metrics = &MetricConfig{ValueAnnotation: "value"}
+		a := alert("disk_percent > 90")
+		a.Annotations["value"] = "93.5"
+
+		Expect(send(a).AonMetricValue).Should(Equal("93.5"))
+	})
+
+	It("Should take the metric value from the grafana values", func() {
+		a := alert("disk_percent > 90")
+		a.Values = map[string]float64{"B": 93.5}
+
+		Expect(send(a).AonMetricValue).Should(Equal("93.5"))
+	})
+
+	It("Should take the metric value from the value string", func() {
+		a := alert("disk_percent > 90")
+		a.ValueString = "[ var='B' value=93.5 ], [ var='C' value=1 ]"
+		a.Values = map[string]float64{"B": 93.5, "C": 1}
+
+		Expect(send(a).AonMetricValue).Should(Equal("[ var='B' value=93.5 ], [ var='C' value=1 ]"))
+	})
+
+	Context("when querying prometheus", func() {
+		BeforeEach(func() {
+			client.Metrics = &MetricConfig{ValueAnnotation: "value", PrometheusURL: prometheusServer.URL()}
+			prometheusServer.Samples = []PrometheusSample{
+				{Metric: map[string]string{"instance": "10.0.0.2:9100"}, Value: []interface{}{1540313079.0, "91"}},
+				{Metric: map[string]string{"instance": "10.0.0.1:9100"}, Value: []interface{}{1540313079.0, "97.2"}},
+			}
+		})
+
+		It("Should use the value of the alert series at the alert start", func() {
+			Expect(send(alert("disk_percent > 90")).AonMetricValue).Should(Equal("97.2"))
+
+			Expect(prometheusServer.ReceivedQueries).Should(HaveLen(1))
+			Expect(prometheusServer.ReceivedQueries[0].Get("query")).Should(Equal("disk_percent > 90"))
+			Expect(prometheusServer.ReceivedQueries[0].Get("time")).Should(Equal("1540313079.000"))
+		})
+
+		It("Should skip the queries for a while after a failure", func() {
+			var requests int32
+			unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer unavailable.Close()
+			client.Metrics = &MetricConfig{PrometheusURL: unavailable.URL, FailureBackoff: time.Hour}
+
+			_, err := client.SendAlerts(context.Background(), []PrometheusAlert{alert("disk_percent > 90"), alert("up == 0")}, moogsoftServer.GetToken())
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(1))
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(2))
+		})
+
+		It("Should not query when the alert has a value", func() {
+			a := alert("disk_percent > 90")
+			a.Annotations["value"] = "93.5"
+
+			Expect(send(a).AonMetricValue).Should(Equal("93.5"))
+			Expect(prometheusServer.ReceivedQueries).Should(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"fmt"
+	"io"
+)
+
+// WriteMetrics writes the client metrics using the Prometheus text
+// exposition format.
+func (c *Client) WriteMetrics(w io.Writer) {
+	labels := fmt.Sprintf(`destination=%q`, c.Destination())
+
+	if c.Limiter != nil {
+		writeMetric(w, "prometheus2moogsoft_throttled_seconds_total", "counter",
+			"Total time requests to moogsoft spent waiting on the rate limiter.",
+			labels, c.Limiter.Throttled().Seconds())
+		writeMetric(w, "prometheus2moogsoft_throttled_requests", "gauge",
+			"Requests to moogsoft currently waiting on the rate limiter.",
+			labels, float64(c.Limiter.Waiting()))
+	}
+
+	if c.Breaker != nil {
+		writeMetric(w, "prometheus2moogsoft_circuit_breaker_state", "gauge",
+			"Circuit breaker state, 0 closed, 1 half-open and 2 open.",
+			labels, float64(c.Breaker.State()))
+	}
+
+	if c.Queue != nil {
+		writeMetric(w, "prometheus2moogsoft_retry_queue_length", "gauge",
+			"Requests to moogsoft waiting to be retried.",
+			labels, float64(c.Queue.Len()))
+		writeMetric(w, "prometheus2moogsoft_dead_letters_total", "counter",
+			"Requests to moogsoft dropped after exhausting their retries.",
+			labels, float64(c.Queue.DeadLetters()))
+	}
+
+	status := c.Status()
+	if status.LastSuccess != nil {
+		writeMetric(w, "prometheus2moogsoft_last_delivery_success_timestamp_seconds", "gauge",
+			"Time of the last successful delivery to moogsoft.",
+			labels, float64(status.LastSuccess.Unix()))
+	}
+	if status.LastFailure != nil {
+		writeMetric(w, "prometheus2moogsoft_last_delivery_failure_timestamp_seconds", "gauge",
+			"Time of the last failed delivery to moogsoft.",
+			labels, float64(status.LastFailure.Unix()))
+	}
+}
+
+func writeMetric(w io.Writer, name string, kind string, help string, labels string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+	fmt.Fprintf(w, "%s{%s} %g\n", name, labels, value)
+}
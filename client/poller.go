@@ -0,0 +1,201 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PrometheusRule is an alerting rule as returned by the prometheus
+// /api/v1/rules endpoint, with its active alerts.
+type PrometheusRule struct {
+	Name   string                `json:"name"`
+	Query  string                `json:"query"`
+	Type   string                `json:"type"`
+	Alerts []PrometheusRuleAlert `json:"alerts"`
+}
+
+// PrometheusRuleAlert is an active alert of a prometheus alerting rule.
+type PrometheusRuleAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	State       string            `json:"state"`
+	ActiveAt    string            `json:"activeAt"`
+	Value       string            `json:"value"`
+}
+
+type prometheusRulesResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		Groups []struct {
+			Rules []PrometheusRule `json:"rules"`
+		} `json:"groups"`
+	} `json:"data"`
+}
+
+// defaultPollTimeout bounds the requests to prometheus when the poller has no
+// http client set.
+const defaultPollTimeout = 10 * time.Second
+
+// PrometheusPoller polls the alerts of a prometheus server running without
+// alertmanager and sends the alerts that started or stopped firing since the
+// previous poll to moogsoft.
+type PrometheusPoller struct {
+	URL        string
+	Client     *Client
+	Token      string
+	HTTPClient *http.Client
+
+	firing map[string]PrometheusAlert
+}
+
+func NewPrometheusPoller(url string, client *Client, token string) *PrometheusPoller {
+	return &PrometheusPoller{
+		URL:        strings.TrimSuffix(url, "/"),
+		Client:     client,
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: defaultPollTimeout},
+	}
+}
+
+// Poll fetches the prometheus alerts once and sends their transitions.
+func (p *PrometheusPoller) Poll(ctx context.Context) error {
+	rules, err := p.fetchRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	firing := map[string]PrometheusAlert{}
+	var transitions []PrometheusAlert
+
+	for _, rule := range rules {
+		for _, ruleAlert := range rule.Alerts {
+			if ruleAlert.State != "firing" {
+				continue
+			}
+
+			key := labelsKey(ruleAlert.Labels)
+			alert := PrometheusAlert{
+				Status:       "firing",
+				Labels:       ruleAlert.Labels,
+				Annotations:  ruleAlert.Annotations,
+				StartsAt:     ruleAlert.ActiveAt,
+				GeneratorURL: p.graphURL(rule.Query),
+				ValueString:  ruleAlert.Value,
+			}
+			firing[key] = alert
+
+			if _, ok := p.firing[key]; !ok {
+				transitions = append(transitions, alert)
+			}
+		}
+	}
+
+	for key, alert := range p.firing {
+		if _, ok := firing[key]; !ok {
+			alert.Status = "resolved"
+			alert.EndsAt = time.Now().UTC().Format(time.RFC3339Nano)
+			transitions = append(transitions, alert)
+		}
+	}
+
+	if len(transitions) > 0 {
+		statusCode, err := p.Client.SendAlerts(ctx, transitions, p.Token)
+		if deliveryFailed(statusCode, err) {
+			// The transitions are sent again on the next poll.
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("Moogsoft responded with status code %d", statusCode)
+		}
+		if statusCode >= 400 {
+			// Moogsoft rejects the events, sending them again would not help.
+			p.firing = firing
+			return fmt.Errorf("Moogsoft responded with status code %d", statusCode)
+		}
+	}
+
+	p.firing = firing
+
+	return nil
+}
+
+// Run polls prometheus every interval until stop is closed.
+func (p *PrometheusPoller) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ctx := WithRequestID(context.Background(), NewRequestID())
+		if err := p.Poll(ctx); err != nil {
+			loggerFor(ctx).Error("Unable to poll prometheus alerts", "prometheus_url", p.URL, "error", err.Error())
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// graphURL returns the link to the expression of the rule in the prometheus
+// graph page, like the generator url prometheus sends to alertmanager.
+func (p *PrometheusPoller) graphURL(query string) string {
+	return p.URL + "/graph?g0.expr=" + url.QueryEscape(query) + "&g0.tab=1"
+}
+
+func (p *PrometheusPoller) fetchRules(ctx context.Context) ([]PrometheusRule, error) {
+	req, err := http.NewRequest("GET", p.URL+"/api/v1/rules?type=alert", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := p.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultPollTimeout}
+	}
+
+	res, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var response prometheusRulesResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("Invalid prometheus response with status code %d: %s", res.StatusCode, err.Error())
+	}
+
+	if response.Status != "success" {
+		return nil, fmt.Errorf("Prometheus responded with %s: %s", response.Status, response.Error)
+	}
+
+	var rules []PrometheusRule
+	for _, group := range response.Data.Groups {
+		for _, rule := range group.Rules {
+			if rule.Type == "" || rule.Type == "alerting" {
+				rules = append(rules, rule)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// labelsKey returns a key identifying a label set.
+func labelsKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, value))
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
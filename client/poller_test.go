@@ -0,0 +1,125 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("PrometheusPoller", func() {
+	var poller *PrometheusPoller
+	var prometheusServer FakePrometheusServer
+	var moogsoftServer FakeMoogsoftServer
+
+	probeAlert := PrometheusRuleAlert{
+		Labels:      map[string]string{"alertname": "ProbeUnsuccesful", "instance": "someuri.com:8080", "service": "probe", "severity": "warning"},
+		Annotations: map[string]string{"description": "probe failing"},
+		State:       "firing",
+		ActiveAt:    "2018-10-23T16:44:39.901211833Z",
+		Value:       "0e+00",
+	}
+
+	probeRule := func(alerts ...PrometheusRuleAlert) []PrometheusRule {
+		return []PrometheusRule{{Name: "ProbeUnsuccesful", Query: "probe_success == 0", Type: "alerting", Alerts: alerts}}
+	}
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+		prometheusServer.Start()
+
+		client := &Client{URL: moogsoftServer.URL(), EventsEndpoint: moogsoftServer.GetEventsEndpoint()}
+		poller = NewPrometheusPoller(prometheusServer.URL(), client, moogsoftServer.GetToken())
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+		prometheusServer.Stop()
+	})
+
+	It("Should send the alerts that started firing", func() {
+		prometheusServer.Rules = probeRule(probeAlert)
+
+		Expect(poller.Poll(context.Background())).Should(Succeed())
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+
+		event := moogsoftServer.ReceivedEvents[0]
+		Expect(event.Signature).Should(Equal("ProbeUnsuccesful::someuri.com:8080"))
+		Expect(event.Severity).Should(Equal(MAJOR))
+		Expect(event.AgentTime).Should(Equal("1540313079"))
+		Expect(event.AonToolUrl).Should(Equal(prometheusServer.URL() + "/graph?g0.expr=probe_success+%3D%3D+0&g0.tab=1"))
+		Expect(event.AonMetricName).Should(Equal("probe_success"))
+	})
+
+	It("Should not send alerts that keep firing again", func() {
+		prometheusServer.Rules = probeRule(probeAlert)
+
+		Expect(poller.Poll(context.Background())).Should(Succeed())
+		Expect(poller.Poll(context.Background())).Should(Succeed())
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+	})
+
+	It("Should ignore pending alerts", func() {
+		pendingAlert := probeAlert
+		pendingAlert.State = "pending"
+		prometheusServer.Rules = probeRule(pendingAlert)
+
+		Expect(poller.Poll(context.Background())).Should(Succeed())
+		Expect(moogsoftServer.ReceivedEvents).Should(BeEmpty())
+	})
+
+	It("Should send the alerts that stopped firing as resolved", func() {
+		prometheusServer.Rules = probeRule(probeAlert)
+		Expect(poller.Poll(context.Background())).Should(Succeed())
+
+		prometheusServer.Rules = probeRule()
+		Expect(poller.Poll(context.Background())).Should(Succeed())
+
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(2))
+		Expect(moogsoftServer.ReceivedEvents[1].Signature).Should(Equal("ProbeUnsuccesful::someuri.com:8080"))
+		Expect(moogsoftServer.ReceivedEvents[1].Severity).Should(Equal(CLEAR))
+	})
+
+	Context("when moogsoft is failing", func() {
+		It("Should send the alerts again on the next poll", func() {
+			prometheusServer.Rules = probeRule(probeAlert)
+			moogsoftServer.FailWith = http.StatusBadGateway
+			Expect(poller.Poll(context.Background())).ShouldNot(Succeed())
+
+			moogsoftServer.FailWith = 0
+			Expect(poller.Poll(context.Background())).Should(Succeed())
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+		})
+	})
+
+	Context("when moogsoft rejects the alerts", func() {
+		It("Should not send them again", func() {
+			prometheusServer.Rules = probeRule(probeAlert)
+			moogsoftServer.FailWith = http.StatusBadRequest
+			Expect(poller.Poll(context.Background())).ShouldNot(Succeed())
+
+			moogsoftServer.FailWith = 0
+			Expect(poller.Poll(context.Background())).Should(Succeed())
+			Expect(moogsoftServer.ReceivedEvents).Should(BeEmpty())
+		})
+	})
+
+	Context("when prometheus is not reachable", func() {
+		It("Should return an error and keep the previous alerts", func() {
+			prometheusServer.Rules = probeRule(probeAlert)
+			Expect(poller.Poll(context.Background())).Should(Succeed())
+
+			prometheusServer.Stop()
+			Expect(poller.Poll(context.Background())).ShouldNot(Succeed())
+
+			prometheusServer.Start()
+			prometheusServer.Rules = probeRule(probeAlert)
+			poller.URL = prometheusServer.URL()
+			Expect(poller.Poll(context.Background())).Should(Succeed())
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+		})
+	})
+})
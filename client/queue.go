@@ -0,0 +1,122 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+type queuedRequest struct {
+	payload   []byte
+	token     string
+	requestID string
+	attempts  int
+	queuedAt  time.Time
+	// delivered is called once moogsoft accepted the request.
+	delivered func()
+}
+
+// RetryQueue keeps the requests that could not be delivered to moogsoft
+// until they can be retried. Requests exceeding MaxAttempts are dropped and
+// counted as dead letters.
+type RetryQueue struct {
+	capacity    int
+	maxAttempts int
+
+	mu          sync.Mutex
+	requests    []queuedRequest
+	deadLetters int64
+}
+
+// NewRetryQueue returns a queue holding up to capacity requests, each retried
+// at most maxAttempts times. A maxAttempts lower or equal than zero retries
+// forever.
+func NewRetryQueue(capacity int, maxAttempts int) *RetryQueue {
+	return &RetryQueue{
+		capacity:    capacity,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Push adds a request to the queue, returning false when the queue is full.
+func (q *RetryQueue) Push(payload []byte, token string, requestID string) bool {
+	return q.push(queuedRequest{payload: payload, token: token, requestID: requestID})
+}
+
+func (q *RetryQueue) push(request queuedRequest) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.requests) >= q.capacity {
+		return false
+	}
+
+	request.queuedAt = time.Now()
+	q.requests = append(q.requests, request)
+
+	return true
+}
+
+// Len returns the number of requests waiting to be retried.
+func (q *RetryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.requests)
+}
+
+// Full reports whether the queue reached its capacity.
+func (q *RetryQueue) Full() bool {
+	return q.Len() >= q.capacity
+}
+
+// DeadLetters returns the number of requests dropped after exhausting their
+// attempts.
+func (q *RetryQueue) DeadLetters() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.deadLetters
+}
+
+// peek returns the oldest request without removing it, so new requests keep
+// queueing behind it while it is retried.
+func (q *RetryQueue) peek() (queuedRequest, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.requests) == 0 {
+		return queuedRequest{}, false
+	}
+
+	return q.requests[0], true
+}
+
+// remove drops the oldest request once it was delivered.
+func (q *RetryQueue) remove() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.requests) > 0 {
+		q.requests = q.requests[1:]
+	}
+}
+
+// failed counts a failed attempt of the oldest request, returning false if it
+// was dead lettered instead of kept at the front of the queue.
+func (q *RetryQueue) failed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.requests) == 0 {
+		return false
+	}
+
+	q.requests[0].attempts++
+	if q.maxAttempts > 0 && q.requests[0].attempts >= q.maxAttempts {
+		q.requests = q.requests[1:]
+		q.deadLetters++
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimiter throttles the requests sent to a Moogsoft destination using a
+// token bucket and caps how many of them can be in flight at the same time.
+// Requests over the limit wait for their turn instead of being dropped.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	slots chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	throttled int64
+	waiting   int64
+}
+
+// NewRateLimiter returns a limiter allowing rate requests per second with
+// bursts of up to burst requests and at most maxConcurrency requests in
+// flight. A rate or maxConcurrency lower or equal than zero disables that
+// limit.
+func NewRateLimiter(rate float64, burst int, maxConcurrency int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	r := &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+
+	if maxConcurrency > 0 {
+		r.slots = make(chan struct{}, maxConcurrency)
+	}
+
+	return r
+}
+
+// Acquire blocks until a request can be sent and returns the function that
+// must be called once the request is done. It gives up with the context
+// error when ctx is done first.
+func (r *RateLimiter) Acquire(ctx context.Context) (func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&r.waiting, 1)
+	defer atomic.AddInt64(&r.waiting, -1)
+
+	// Only the requests that had to wait count as throttled.
+	start := time.Now()
+	waited := false
+	defer func() {
+		if waited {
+			atomic.AddInt64(&r.throttled, int64(time.Since(start)))
+		}
+	}()
+
+	if wait := r.reserve(); wait > 0 {
+		waited = true
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			r.refund()
+			return nil, ctx.Err()
+		}
+	}
+
+	if r.slots != nil {
+		select {
+		case r.slots <- struct{}{}:
+		default:
+			waited = true
+			select {
+			case r.slots <- struct{}{}:
+			case <-ctx.Done():
+				r.refund()
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	return func() {
+		if r.slots != nil {
+			<-r.slots
+		}
+	}, nil
+}
+
+// Throttled returns the total time requests spent waiting on the limiter.
+func (r *RateLimiter) Throttled() time.Duration {
+	return time.Duration(atomic.LoadInt64(&r.throttled))
+}
+
+// Waiting returns the number of requests currently queued on the limiter.
+func (r *RateLimiter) Waiting() int64 {
+	return atomic.LoadInt64(&r.waiting)
+}
+
+// reserve takes a token from the bucket and returns how long the caller has
+// to wait before using it. Tokens can go negative so waiting requests are
+// served in arrival order.
+func (r *RateLimiter) reserve() time.Duration {
+	if r.rate <= 0 {
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+
+	r.tokens--
+	if r.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-r.tokens / r.rate * float64(time.Second))
+}
+
+// refund gives back the token of a request that gave up waiting.
+func (r *RateLimiter) refund() {
+	if r.rate <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.tokens++; r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+}
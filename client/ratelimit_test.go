@@ -0,0 +1,124 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("RateLimiter", func() {
+	Context("when the rate limit is exceeded", func() {
+		It("Should queue requests instead of dropping them", func() {
+			limiter := NewRateLimiter(20, 1, 0)
+
+			start := time.Now()
+			for i := 0; i < 3; i++ {
+				release, err := limiter.Acquire(context.Background())
+				Expect(err).ShouldNot(HaveOccurred())
+				release()
+			}
+
+			Expect(time.Since(start)).Should(BeNumerically(">=", 90*time.Millisecond))
+			Expect(limiter.Throttled()).Should(BeNumerically(">=", 90*time.Millisecond))
+			Expect(limiter.Waiting()).Should(BeZero())
+		})
+	})
+
+	Context("when requests are within the burst", func() {
+		It("Should not throttle them", func() {
+			limiter := NewRateLimiter(1, 5, 0)
+
+			for i := 0; i < 5; i++ {
+				release, err := limiter.Acquire(context.Background())
+				Expect(err).ShouldNot(HaveOccurred())
+				release()
+			}
+
+			Expect(limiter.Throttled()).Should(BeZero())
+		})
+	})
+
+	Context("when the request is canceled while waiting", func() {
+		It("Should give up with the context error", func() {
+			limiter := NewRateLimiter(1, 1, 0)
+			release, err := limiter.Acquire(context.Background())
+			Expect(err).ShouldNot(HaveOccurred())
+			release()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			_, err = limiter.Acquire(ctx)
+
+			Expect(err).Should(MatchError(context.DeadlineExceeded))
+			Expect(time.Since(start)).Should(BeNumerically("<", 500*time.Millisecond))
+			Expect(limiter.Waiting()).Should(BeZero())
+		})
+
+		It("Should neither queue nor count it as a moogsoft failure", func() {
+			var moogsoftServer FakeMoogsoftServer
+			moogsoftServer.Start()
+			defer moogsoftServer.Stop()
+
+			client := &Client{
+				URL:            moogsoftServer.URL(),
+				EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+				Limiter:        NewRateLimiter(1, 1, 0),
+				Breaker:        NewCircuitBreaker(1, time.Hour),
+				Queue:          NewRetryQueue(10, 0),
+			}
+			payload := `{"alerts": [{"status": "firing", "labels": {"alertname": "Down", "instance": "someuri.com:8080", "service": "probe", "severity": "warning"}}]}`
+
+			_, err := client.SendEventsContext(context.Background(), payload, moogsoftServer.GetToken())
+			Expect(err).ShouldNot(HaveOccurred())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err = client.SendEventsContext(ctx, payload, moogsoftServer.GetToken())
+
+			Expect(errors.Is(err, ErrRequestCanceled)).Should(BeTrue())
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+			Expect(client.Queue.Len()).Should(BeZero())
+			Expect(client.Breaker.State()).Should(Equal(CLOSED))
+		})
+	})
+
+	Context("when max concurrency is set", func() {
+		It("Should not allow more requests in flight", func() {
+			limiter := NewRateLimiter(0, 0, 2)
+
+			var inFlight, maxInFlight int64
+			var wg sync.WaitGroup
+
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					release, _ := limiter.Acquire(context.Background())
+					defer release()
+
+					current := atomic.AddInt64(&inFlight, 1)
+					for {
+						max := atomic.LoadInt64(&maxInFlight)
+						if current <= max || atomic.CompareAndSwapInt64(&maxInFlight, max, current) {
+							break
+						}
+					}
+					time.Sleep(10 * time.Millisecond)
+					atomic.AddInt64(&inFlight, -1)
+				}()
+			}
+
+			wg.Wait()
+			Expect(maxInFlight).Should(Equal(int64(2)))
+		})
+	})
+})
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AlertmanagerAlert is an alert as returned by the alertmanager
+// /api/v2/alerts endpoint.
+type AlertmanagerAlert struct {
+	Labels       map[string]string      `json:"labels"`
+	Annotations  map[string]string      `json:"annotations"`
+	StartsAt     string                 `json:"startsAt"`
+	EndsAt       string                 `json:"endsAt"`
+	UpdatedAt    string                 `json:"updatedAt"`
+	GeneratorURL string                 `json:"generatorURL"`
+	Fingerprint  string                 `json:"fingerprint"`
+	Receivers    []AlertmanagerReceiver `json:"receivers"`
+	Status       struct {
+		State string `json:"state"`
+	} `json:"status"`
+}
+
+// AlertmanagerReceiver is a receiver an alertmanager alert is routed to.
+type AlertmanagerReceiver struct {
+	Name string `json:"name"`
+}
+
+// defaultAlertmanagerTimeout bounds the requests to alertmanager when no http
+// client is set.
+const defaultAlertmanagerTimeout = 10 * time.Second
+
+// Reconciler compares the alerts active in alertmanager with the ones the
+// registry believes are open in moogsoft. Open alerts no longer active get
+// resolved, and active alerts missing in moogsoft get sent again, so a lost
+// webhook does not leave moogsoft out of sync.
+//
+// The registry only knows the alerts delivered by this instance, so the
+// reconciler must run on a single instance.
+type Reconciler struct {
+	AlertmanagerURL string
+	// Receiver restricts the alerts to the ones routed to the alertmanager
+	// receivers matching this regular expression, the ones sending their
+	// webhooks to this app. All alerts are reconciled when empty.
+	Receiver   string
+	Client     *Client
+	Token      string
+	HTTPClient *http.Client
+}
+
+func NewReconciler(alertmanagerURL string, client *Client, token string) *Reconciler {
+	return &Reconciler{
+		AlertmanagerURL: strings.TrimSuffix(alertmanagerURL, "/"),
+		Client:          client,
+		Token:           token,
+		HTTPClient:      &http.Client{Timeout: defaultAlertmanagerTimeout},
+	}
+}
+
+// Reconcile syncs moogsoft with alertmanager once.
+func (r *Reconciler) Reconcile(ctx context.Context) error {
+	if r.Client.Registry == nil {
+		return fmt.Errorf("Reconciling requires the alert registry")
+	}
+
+	alertmanagerAlerts, err := fetchAlertmanagerAlerts(ctx, r.httpClient(), r.AlertmanagerURL, r.Receiver)
+	if err != nil {
+		return err
+	}
+
+	active := map[string]bool{}
+	var alerts []PrometheusAlert
+
+	for _, alertmanagerAlert := range alertmanagerAlerts {
+		alert := PrometheusAlert{
+			Status:       "firing",
+			Labels:       alertmanagerAlert.Labels,
+			Annotations:  alertmanagerAlert.Annotations,
+			StartsAt:     alertmanagerAlert.StartsAt,
+			GeneratorURL: alertmanagerAlert.GeneratorURL,
+			Fingerprint:  alertmanagerAlert.Fingerprint,
+		}
+		signature := r.Client.signatureFor(alert)
+		active[signature] = true
+
+		// Silenced and inhibited alerts are not notified by alertmanager
+		// either, they only keep their moogsoft alert open.
+		if alertmanagerAlert.Status.State != "active" {
+			continue
+		}
+
+		// Heartbeats only count when notified by alertmanager.
+		if r.Client.Heartbeats.IsHeartbeat(alert) {
+			continue
+		}
+
+		if _, ok := r.Client.Registry.Get(signature); !ok {
+			alerts = append(alerts, alert)
+		}
+	}
+
+	for _, record := range r.Client.Registry.Open() {
+		// Missing heartbeat events are resolved by the heartbeat monitor.
+		if !active[record.Signature] && record.Alert.Labels["service"] != "heartbeat" {
+			alert := record.Alert
+			alert.Status = "resolved"
+			alert.EndsAt = time.Now().UTC().Format(time.RFC3339Nano)
+			alerts = append(alerts, alert)
+		}
+	}
+
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	loggerFor(ctx).Info("Reconciling moogsoft with alertmanager", "alerts", len(alerts))
+
+	statusCode, err := r.Client.SendAlerts(ctx, alerts, r.Token)
+	if err != nil {
+		return err
+	}
+	if statusCode >= 400 {
+		return fmt.Errorf("Moogsoft responded with status code %d", statusCode)
+	}
+
+	return nil
+}
+
+// Run reconciles every interval until stop is closed.
+func (r *Reconciler) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx := WithRequestID(context.Background(), NewRequestID())
+			if err := r.Reconcile(ctx); err != nil {
+				loggerFor(ctx).Error("Unable to reconcile moogsoft with alertmanager", "alertmanager_url", r.AlertmanagerURL, "error", err.Error())
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (r *Reconciler) httpClient() *http.Client {
+	if r.HTTPClient == nil {
+		return &http.Client{Timeout: defaultAlertmanagerTimeout}
+	}
+
+	return r.HTTPClient
+}
+
+// fetchAlertmanagerAlerts returns the alerts of alertmanager routed to the
+// receivers matching receiver, or all of them when it is empty.
+func fetchAlertmanagerAlerts(ctx context.Context, httpClient *http.Client, alertmanagerURL string, receiver string) ([]AlertmanagerAlert, error) {
+	query := url.Values{}
+	for _, filter := range []string{"active", "silenced", "inhibited", "unprocessed"} {
+		query.Set(filter, "true")
+	}
+	if receiver != "" {
+		query.Set("receiver", receiver)
+	}
+
+	req, err := http.NewRequest("GET", alertmanagerURL+"/api/v2/alerts?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Alertmanager responded with status code %d", res.StatusCode)
+	}
+
+	var alerts []AlertmanagerAlert
+	if err := json.NewDecoder(res.Body).Decode(&alerts); err != nil {
+		return nil, fmt.Errorf("Invalid alertmanager response: %s", err.Error())
+	}
+
+	return alerts, nil
+}
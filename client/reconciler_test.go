@@ -0,0 +1,129 @@
+package client_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("Reconciler", func() {
+	var reconciler *Reconciler
+	var client *Client
+	var alertmanagerServer FakeAlertmanagerServer
+	var moogsoftServer FakeMoogsoftServer
+
+	alertmanagerAlert := func(instance string, state string) AlertmanagerAlert {
+		alert := AlertmanagerAlert{
+			Labels:      map[string]string{"alertname": "ProbeUnsuccesful", "instance": instance, "service": "probe", "severity": "warning"},
+			Annotations: map[string]string{"description": "probe failing"},
+			StartsAt:    "2018-10-23T16:44:39.901211833Z",
+			Receivers:   []AlertmanagerReceiver{{Name: "moogsoft"}},
+		}
+		alert.Status.State = state
+		return alert
+	}
+
+	sendFiring := func(instance string) {
+		_, err := client.SendAlerts(context.Background(), []PrometheusAlert{{
+			Status:   "firing",
+			Labels:   map[string]string{"alertname": "ProbeUnsuccesful", "instance": instance, "service": "probe", "severity": "warning"},
+			StartsAt: "2018-10-23T16:44:39.901211833Z",
+		}}, moogsoftServer.GetToken())
+		Expect(err).ShouldNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+		alertmanagerServer.Start()
+
+		client = &Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+			Registry:       NewRegistry(),
+		}
+		reconciler = NewReconciler(alertmanagerServer.URL(), client, moogsoftServer.GetToken())
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+		alertmanagerServer.Stop()
+	})
+
+	Context("when an open alert is no longer active in alertmanager", func() {
+		It("Should resolve it in moogsoft", func() {
+			sendFiring("someuri.com:8080")
+
+			Expect(reconciler.Reconcile(context.Background())).Should(Succeed())
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(2))
+			Expect(moogsoftServer.ReceivedEvents[1].Signature).Should(Equal("ProbeUnsuccesful::someuri.com:8080"))
+			Expect(moogsoftServer.ReceivedEvents[1].Severity).Should(Equal(CLEAR))
+			Expect(client.Registry.Open()).Should(BeEmpty())
+		})
+	})
+
+	Context("when an active alert is missing in moogsoft", func() {
+		It("Should send it again", func() {
+			alertmanagerServer.Alerts = []AlertmanagerAlert{alertmanagerAlert("someuri.com:8080", "active")}
+
+			Expect(reconciler.Reconcile(context.Background())).Should(Succeed())
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+			Expect(moogsoftServer.ReceivedEvents[0].Severity).Should(Equal(MAJOR))
+			Expect(client.Registry.Open()).Should(HaveLen(1))
+		})
+
+		It("Should not send it when it is routed to another receiver", func() {
+			alertmanagerServer.Alerts = []AlertmanagerAlert{alertmanagerAlert("someuri.com:8080", "active")}
+			reconciler.Receiver = "slack|email"
+
+			Expect(reconciler.Reconcile(context.Background())).Should(Succeed())
+			Expect(moogsoftServer.ReceivedEvents).Should(BeEmpty())
+
+			reconciler.Receiver = "moogsoft"
+			Expect(reconciler.Reconcile(context.Background())).Should(Succeed())
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+		})
+
+		It("Should not send it when it is silenced", func() {
+			alertmanagerServer.Alerts = []AlertmanagerAlert{alertmanagerAlert("someuri.com:8080", "suppressed")}
+
+			Expect(reconciler.Reconcile(context.Background())).Should(Succeed())
+			Expect(moogsoftServer.ReceivedEvents).Should(BeEmpty())
+		})
+	})
+
+	Context("when moogsoft and alertmanager agree", func() {
+		It("Should not send anything", func() {
+			sendFiring("someuri.com:8080")
+			alertmanagerServer.Alerts = []AlertmanagerAlert{alertmanagerAlert("someuri.com:8080", "active")}
+
+			Expect(reconciler.Reconcile(context.Background())).Should(Succeed())
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+		})
+
+		It("Should keep silenced alerts open", func() {
+			sendFiring("someuri.com:8080")
+			alertmanagerServer.Alerts = []AlertmanagerAlert{alertmanagerAlert("someuri.com:8080", "suppressed")}
+
+			Expect(reconciler.Reconcile(context.Background())).Should(Succeed())
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+			Expect(client.Registry.Open()).Should(HaveLen(1))
+		})
+	})
+
+	Context("when alertmanager is not reachable", func() {
+		It("Should not resolve anything", func() {
+			sendFiring("someuri.com:8080")
+			alertmanagerServer.Stop()
+
+			Expect(reconciler.Reconcile(context.Background())).ShouldNot(Succeed())
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+
+			alertmanagerServer.Start()
+		})
+	})
+})
@@ -0,0 +1,212 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertRecord is the last event sent to moogsoft for a signature. Its alert is
+// kept as received, before relabelling.
+type AlertRecord struct {
+	Signature   string          `json:"signature"`
+	Severity    Severity        `json:"severity"`
+	LastSent    time.Time       `json:"last_sent"`
+	Alert       PrometheusAlert `json:"alert"`
+	Destination string          `json:"destination"`
+	// SilenceID is the alertmanager silence created when the alert was
+	// acknowledged in moogsoft.
+	SilenceID string `json:"silence_id,omitempty"`
+}
+
+// RegistryFilter selects records, empty fields match every record.
+type RegistryFilter struct {
+	Signature   string
+	Severity    *Severity
+	Destination string
+	Labels      map[string]string
+}
+
+func (f RegistryFilter) matches(record AlertRecord) bool {
+	if f.Signature != "" && !strings.Contains(record.Signature, f.Signature) {
+		return false
+	}
+
+	if f.Severity != nil && record.Severity != *f.Severity {
+		return false
+	}
+
+	if f.Destination != "" && record.Destination != f.Destination {
+		return false
+	}
+
+	for name, value := range f.Labels {
+		if record.Alert.Labels[name] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Registry keeps track of the alerts the bridge believes are open in
+// moogsoft. When it has a path, the records are saved to that file after
+// every change so they survive restarts.
+type Registry struct {
+	path string
+
+	mu      sync.Mutex
+	records map[string]AlertRecord
+}
+
+// NewRegistry returns a registry kept in memory.
+func NewRegistry() *Registry {
+	return &Registry{records: map[string]AlertRecord{}}
+}
+
+// OpenRegistry returns a registry persisted in the file at path, loading the
+// records saved by a previous run.
+func OpenRegistry(path string) (*Registry, error) {
+	r := NewRegistry()
+	r.path = path
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &r.records); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Record stores the events delivered for the alerts, forgetting the
+// signatures of the resolved alerts, and saves the registry once.
+func (r *Registry) Record(events []MoogsoftEvent, alerts []PrometheusAlert, destination string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for i, event := range events {
+		if alerts[i].Status == "resolved" || event.Severity == CLEAR {
+			delete(r.records, event.Signature)
+			continue
+		}
+
+		r.records[event.Signature] = AlertRecord{
+			Signature:   event.Signature,
+			Severity:    event.Severity,
+			LastSent:    now,
+			Alert:       alerts[i],
+			Destination: destination,
+			SilenceID:   r.records[event.Signature].SilenceID,
+		}
+	}
+
+	return r.save()
+}
+
+// SetSilence stores the alertmanager silence of the signature, an empty
+// silenceID forgets it.
+func (r *Registry) SetSilence(signature string, silenceID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[signature]
+	if !ok {
+		return ErrUnknownSignature
+	}
+
+	record.SilenceID = silenceID
+	r.records[signature] = record
+
+	return r.save()
+}
+
+// Get returns the record of the signature.
+func (r *Registry) Get(signature string) (AlertRecord, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[signature]
+	return record, ok
+}
+
+// Open returns the records of every open alert.
+func (r *Registry) Open() []AlertRecord {
+	return r.Query(RegistryFilter{})
+}
+
+// Query returns the records matching the filter sorted by signature.
+func (r *Registry) Query(filter RegistryFilter) []AlertRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records := []AlertRecord{}
+	for _, record := range r.records {
+		if filter.matches(record) {
+			records = append(records, record)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Signature < records[j].Signature
+	})
+
+	return records
+}
+
+// Len returns the number of open alerts.
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.records)
+}
+
+// save writes the records to the registry file.
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	return saveJSON(r.path, r.records)
+}
+
+// saveJSON writes value to a temporary file renamed over path, so a crash
+// never leaves it half written.
+func saveJSON(path string, value interface{}) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,99 @@
+package client_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("Registry", func() {
+	var registry *Registry
+	var dir string
+
+	alert := func(environment string) PrometheusAlert {
+		return PrometheusAlert{
+			Status: "firing",
+			Labels: map[string]string{"alertname": "SomeAlert", "environment": environment},
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "registry")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		registry, err = OpenRegistry(filepath.Join(dir, "registry.json"))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(registry.Record([]MoogsoftEvent{{Signature: "SomeAlert::dev", Severity: MAJOR}}, []PrometheusAlert{alert("dev")}, "https://moogsoft-a")).Should(Succeed())
+		Expect(registry.Record([]MoogsoftEvent{{Signature: "SomeAlert::prod", Severity: CRITICAL}}, []PrometheusAlert{alert("prod")}, "https://moogsoft-b")).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("Should keep the last event sent per signature", func() {
+		record, ok := registry.Get("SomeAlert::dev")
+		Expect(ok).Should(BeTrue())
+		Expect(record.Severity).Should(Equal(MAJOR))
+		Expect(record.Destination).Should(Equal("https://moogsoft-a"))
+		Expect(record.Alert.Labels["environment"]).Should(Equal("dev"))
+		Expect(record.LastSent).ShouldNot(BeZero())
+	})
+
+	It("Should forget resolved alerts", func() {
+		resolved := alert("dev")
+		resolved.Status = "resolved"
+		Expect(registry.Record([]MoogsoftEvent{{Signature: "SomeAlert::dev", Severity: CLEAR}}, []PrometheusAlert{resolved}, "https://moogsoft-a")).Should(Succeed())
+
+		_, ok := registry.Get("SomeAlert::dev")
+		Expect(ok).Should(BeFalse())
+		Expect(registry.Len()).Should(Equal(1))
+	})
+
+	It("Should load the records saved by a previous run", func() {
+		reopened, err := OpenRegistry(filepath.Join(dir, "registry.json"))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		records := reopened.Open()
+		Expect(records).Should(HaveLen(2))
+		for i, record := range registry.Open() {
+			Expect(records[i].Signature).Should(Equal(record.Signature))
+			Expect(records[i].Severity).Should(Equal(record.Severity))
+			Expect(records[i].Alert).Should(Equal(record.Alert))
+			Expect(records[i].LastSent).Should(BeTemporally("==", record.LastSent))
+		}
+	})
+
+	Context("#Query", func() {
+		It("Should filter by severity", func() {
+			severity := CRITICAL
+			records := registry.Query(RegistryFilter{Severity: &severity})
+			Expect(records).Should(HaveLen(1))
+			Expect(records[0].Signature).Should(Equal("SomeAlert::prod"))
+		})
+
+		It("Should filter by destination", func() {
+			records := registry.Query(RegistryFilter{Destination: "https://moogsoft-a"})
+			Expect(records).Should(HaveLen(1))
+			Expect(records[0].Signature).Should(Equal("SomeAlert::dev"))
+		})
+
+		It("Should filter by labels", func() {
+			records := registry.Query(RegistryFilter{Labels: map[string]string{"environment": "prod"}})
+			Expect(records).Should(HaveLen(1))
+			Expect(records[0].Signature).Should(Equal("SomeAlert::prod"))
+		})
+
+		It("Should filter by signature", func() {
+			Expect(registry.Query(RegistryFilter{Signature: "SomeAlert"})).Should(HaveLen(2))
+			Expect(registry.Query(RegistryFilter{Signature: "Other"})).Should(BeEmpty())
+		})
+	})
+})
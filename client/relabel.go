@@ -0,0 +1,153 @@
+package client
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RelabelConfig is a prometheus style relabel rule applied to the labels, or
+// the annotations, of the alerts before they are mapped to moogsoft events.
+type RelabelConfig struct {
+	SourceLabels []string `yaml:"source_labels"`
+	// Separator joins the values of the source labels, defaults to ;.
+	Separator string `yaml:"separator"`
+	// Regex is anchored on both ends, defaults to (.*).
+	Regex       string `yaml:"regex"`
+	TargetLabel string `yaml:"target_label"`
+	// Replacement may reference the regex groups, defaults to $1.
+	Replacement *string `yaml:"replacement"`
+	Modulus     uint64  `yaml:"modulus"`
+	// Action is replace (default), lowercase, hashmod, labelmap, labeldrop or
+	// labelkeep.
+	Action string `yaml:"action"`
+	// Annotations applies the rule to the annotations instead of the labels.
+	Annotations bool `yaml:"annotations"`
+
+	re *regexp.Regexp
+}
+
+// Validate checks the rule and compiles its regex.
+func (r *RelabelConfig) Validate() error {
+	if r.Action == "" {
+		r.Action = "replace"
+	}
+	if r.Regex == "" {
+		r.Regex = "(.*)"
+	}
+
+	var err error
+	if r.re, err = regexp.Compile("^(?:" + r.Regex + ")$"); err != nil {
+		return fmt.Errorf("Invalid relabel regex %q: %s", r.Regex, err.Error())
+	}
+
+	switch r.Action {
+	case "replace", "lowercase":
+		if r.TargetLabel == "" {
+			return fmt.Errorf("Relabel action %s requires a target_label", r.Action)
+		}
+	case "hashmod":
+		if r.TargetLabel == "" || r.Modulus == 0 {
+			return fmt.Errorf("Relabel action hashmod requires a target_label and a modulus")
+		}
+	case "labelmap", "labeldrop", "labelkeep":
+	default:
+		return fmt.Errorf("Invalid relabel action: %s", r.Action)
+	}
+
+	return nil
+}
+
+func (r *RelabelConfig) replacement() string {
+	if r.Replacement == nil {
+		return "$1"
+	}
+
+	return *r.Replacement
+}
+
+// apply relabels the values in place.
+func (r *RelabelConfig) apply(values map[string]string) {
+	sources := make([]string, len(r.SourceLabels))
+	for i, name := range r.SourceLabels {
+		sources[i] = values[name]
+	}
+	separator := r.Separator
+	if separator == "" {
+		separator = ";"
+	}
+	source := strings.Join(sources, separator)
+
+	switch r.Action {
+	case "replace":
+		match := r.re.FindStringSubmatchIndex(source)
+		if match == nil {
+			return
+		}
+		target := string(r.re.ExpandString(nil, r.TargetLabel, source, match))
+		value := string(r.re.ExpandString(nil, r.replacement(), source, match))
+		if value == "" {
+			delete(values, target)
+		} else {
+			values[target] = value
+		}
+
+	case "lowercase":
+		values[r.TargetLabel] = strings.ToLower(source)
+
+	case "hashmod":
+		sum := md5.Sum([]byte(source))
+		values[r.TargetLabel] = fmt.Sprintf("%d", binary.BigEndian.Uint64(sum[8:])%r.Modulus)
+
+	case "labelmap":
+		mapped := map[string]string{}
+		for name, value := range values {
+			if match := r.re.FindStringSubmatchIndex(name); match != nil {
+				mapped[string(r.re.ExpandString(nil, r.replacement(), name, match))] = value
+			}
+		}
+		for name, value := range mapped {
+			values[name] = value
+		}
+
+	case "labeldrop", "labelkeep":
+		for name := range values {
+			if r.re.MatchString(name) == (r.Action == "labeldrop") {
+				delete(values, name)
+			}
+		}
+	}
+}
+
+// relabel returns a copy of the alert with the relabel rules applied in
+// order.
+func relabel(alert PrometheusAlert, rules []RelabelConfig) PrometheusAlert {
+	if len(rules) == 0 {
+		return alert
+	}
+
+	alert.receivedLabels = alert.Labels
+	alert.Labels = copyValues(alert.Labels)
+	alert.Annotations = copyValues(alert.Annotations)
+
+	for i := range rules {
+		if rules[i].Annotations {
+			rules[i].apply(alert.Annotations)
+		} else {
+			rules[i].apply(alert.Labels)
+		}
+	}
+
+	return alert
+}
+
+func copyValues(values map[string]string) map[string]string {
+	copied := make(map[string]string, len(values))
+	for name, value := range values {
+		copied[name] = value
+	}
+
+	return copied
+}
@@ -0,0 +1,166 @@
+package client_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("Relabel", func() {
+	var client *Client
+	var moogsoftServer FakeMoogsoftServer
+
+	alert := PrometheusAlert{
+		Status: "firing",
+		Labels: map[string]string{
+			"alertname":  "Down",
+			"env":        "PROD",
+			"deployment": "cf",
+			"service":    "cf",
+			"severity":   "warning",
+			"tmp_shard":  "x",
+		},
+		Annotations: map[string]string{"description": "cf is down", "runbook": "https://runbooks/down"},
+		StartsAt:    "2018-10-23T16:44:39.901211833Z",
+	}
+
+	empty := ""
+	rule := func(r RelabelConfig) RelabelConfig {
+		Expect(r.Validate()).Should(Succeed())
+		return r
+	}
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+
+		client = &Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+			Registry:       NewRegistry(),
+			CustomInfo:     &CustomInfoConfig{Labels: true, Annotations: []string{"*"}},
+		}
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+	})
+
+	send := func() MoogsoftEvent {
+		_, err := client.SendAlerts(context.Background(), []PrometheusAlert{alert}, moogsoftServer.GetToken())
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+
+		return moogsoftServer.ReceivedEvents[0]
+	}
+
+	// sent returns the labels or annotations of the event custom info.
+	sent := func(event MoogsoftEvent, key string) map[string]interface{} {
+		return event.CustomInfo[key].(map[string]interface{})
+	}
+
+	It("Should build consistent signatures from differently named labels", func() {
+		client.Relabel = []RelabelConfig{
+			rule(RelabelConfig{SourceLabels: []string{"env"}, TargetLabel: "environment", Action: "lowercase"}),
+			rule(RelabelConfig{Regex: "(deployment)", Replacement: stringPtr("bosh_$1"), Action: "labelmap"}),
+			rule(RelabelConfig{Regex: "env|deployment", Action: "labeldrop"}),
+		}
+
+		event := send()
+
+		Expect(event.Signature).Should(Equal("Down::prod::cf"))
+		Expect(sent(event, "labels")).ShouldNot(HaveKey("env"))
+		Expect(sent(event, "labels")).Should(HaveKeyWithValue("bosh_deployment", "cf"))
+		Expect(client.Registry.Open()[0].Alert.Labels).Should(Equal(alert.Labels))
+	})
+
+	It("Should replace with the regex groups", func() {
+		client.Relabel = []RelabelConfig{
+			rule(RelabelConfig{SourceLabels: []string{"alertname", "deployment"}, Separator: "/", Regex: "(.+)/(.+)", TargetLabel: "environment", Replacement: stringPtr("$2-$1")}),
+			rule(RelabelConfig{SourceLabels: []string{"missing"}, Regex: "(.+)", TargetLabel: "environment", Replacement: stringPtr("never")}),
+		}
+
+		Expect(sent(send(), "labels")).Should(HaveKeyWithValue("environment", "cf-Down"))
+	})
+
+	It("Should delete the target when the replacement is empty", func() {
+		client.Relabel = []RelabelConfig{
+			rule(RelabelConfig{TargetLabel: "tmp_shard", Replacement: &empty}),
+		}
+
+		Expect(sent(send(), "labels")).ShouldNot(HaveKey("tmp_shard"))
+	})
+
+	It("Should keep only the matching labels", func() {
+		client.Relabel = []RelabelConfig{
+			rule(RelabelConfig{Regex: "alertname|service|severity|env|deployment", Action: "labelkeep"}),
+		}
+
+		Expect(sent(send(), "labels")).Should(HaveLen(5))
+	})
+
+	It("Should hash the source labels", func() {
+		client.Relabel = []RelabelConfig{
+			rule(RelabelConfig{SourceLabels: []string{"alertname"}, TargetLabel: "shard", Modulus: 4, Action: "hashmod"}),
+		}
+
+		Expect(sent(send(), "labels")).Should(HaveKeyWithValue("shard", MatchRegexp(`^[0-3]$`)))
+	})
+
+	It("Should relabel the annotations", func() {
+		client.Relabel = []RelabelConfig{
+			rule(RelabelConfig{SourceLabels: []string{"description"}, TargetLabel: "description", Replacement: stringPtr("[cf] $1"), Annotations: true}),
+			rule(RelabelConfig{Regex: "runbook", Action: "labeldrop", Annotations: true}),
+		}
+
+		event := send()
+
+		Expect(event.Description).Should(Equal("[cf] cf is down"))
+		Expect(sent(event, "annotations")).ShouldNot(HaveKey("runbook"))
+	})
+
+	It("Should not change the received alert", func() {
+		client.Relabel = []RelabelConfig{
+			rule(RelabelConfig{Regex: "env", Action: "labeldrop"}),
+		}
+
+		send()
+
+		Expect(alert.Labels).Should(HaveKey("env"))
+	})
+
+	It("Should only relabel once the alerts sent again", func() {
+		client.Relabel = []RelabelConfig{
+			rule(RelabelConfig{SourceLabels: []string{"env"}, TargetLabel: "environment", Action: "lowercase"}),
+			rule(RelabelConfig{Regex: "(deployment)", Replacement: stringPtr("bosh_$1"), Action: "labelmap"}),
+			rule(RelabelConfig{Regex: "env|deployment", Action: "labeldrop"}),
+		}
+		send()
+
+		checker := &StaleChecker{
+			Client: client,
+			Token:  moogsoftServer.GetToken(),
+			Config: StaleConfig{StaleRule: StaleRule{RepeatInterval: time.Hour, Multiplier: 1}},
+		}
+		Expect(checker.Check(context.Background(), time.Now().Add(2*time.Hour))).Should(Succeed())
+
+		Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(2))
+		Expect(moogsoftServer.ReceivedEvents[1].Signature).Should(Equal("Down::prod::cf"))
+		Expect(moogsoftServer.ReceivedEvents[1].Severity).Should(Equal(CLEAR))
+		Expect(client.Registry.Open()).Should(BeEmpty())
+	})
+
+	It("Should reject invalid rules", func() {
+		Expect((&RelabelConfig{Action: "rename"}).Validate()).ShouldNot(Succeed())
+		Expect((&RelabelConfig{Action: "replace"}).Validate()).ShouldNot(Succeed())
+		Expect((&RelabelConfig{Action: "hashmod", TargetLabel: "shard"}).Validate()).ShouldNot(Succeed())
+		Expect((&RelabelConfig{Regex: "(", Action: "labeldrop"}).Validate()).ShouldNot(Succeed())
+	})
+})
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,223 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownSignature = errors.New("No open alert with this signature")
+	ErrUnknownAction    = errors.New("Unknown callback action")
+)
+
+// MoogsoftCallback is the body sent by the moogsoft outbound integration when
+// an operator acts on an alert raised by the bridge.
+type MoogsoftCallback struct {
+	Signature string `json:"signature"`
+	// Action is ack, own or maintenance to silence the alert in
+	// alertmanager, and unack, disown or close to expire its silence.
+	Action  string `json:"action"`
+	User    string `json:"user"`
+	Comment string `json:"comment"`
+}
+
+// AlertmanagerSilence is a silence of the alertmanager v2 API.
+type AlertmanagerSilence struct {
+	ID        string                `json:"id,omitempty"`
+	Matchers  []AlertmanagerMatcher `json:"matchers"`
+	StartsAt  string                `json:"startsAt"`
+	EndsAt    string                `json:"endsAt"`
+	CreatedBy string                `json:"createdBy"`
+	Comment   string                `json:"comment"`
+}
+
+type AlertmanagerMatcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	IsEqual bool   `json:"isEqual"`
+}
+
+// Silencer creates and expires the alertmanager silences of the alerts
+// handled in moogsoft, so alertmanager stops paging for them.
+type Silencer struct {
+	AlertmanagerURL string
+	Client          *Client
+	HTTPClient      *http.Client
+	// Duration is how long silences last unless expired earlier.
+	Duration time.Duration
+}
+
+func NewSilencer(alertmanagerURL string, client *Client, duration time.Duration) *Silencer {
+	return &Silencer{
+		AlertmanagerURL: strings.TrimSuffix(alertmanagerURL, "/"),
+		Client:          client,
+		HTTPClient:      &http.Client{Timeout: defaultAlertmanagerTimeout},
+		Duration:        duration,
+	}
+}
+
+// Handle creates or expires the silence of the alert with the callback
+// signature.
+func (s *Silencer) Handle(ctx context.Context, callback MoogsoftCallback) error {
+	if s.Client.Registry == nil {
+		return fmt.Errorf("Silencing requires the alert registry")
+	}
+
+	record, ok := s.Client.Registry.Get(callback.Signature)
+	if !ok {
+		return ErrUnknownSignature
+	}
+
+	logger := loggerFor(ctx).With("signature", callback.Signature, "action", callback.Action)
+
+	switch callback.Action {
+	case "ack", "own", "maintenance":
+		if record.SilenceID != "" {
+			return nil
+		}
+
+		silenceID, err := s.createSilence(ctx, record.Alert, callback)
+		if err != nil {
+			return err
+		}
+		logger.Info("Created alertmanager silence", "silence_id", silenceID)
+
+		return s.Client.Registry.SetSilence(callback.Signature, silenceID)
+
+	case "unack", "disown", "close":
+		if record.SilenceID == "" {
+			return nil
+		}
+
+		if err := s.expireSilence(ctx, record.SilenceID); err != nil {
+			return err
+		}
+		logger.Info("Expired alertmanager silence", "silence_id", record.SilenceID)
+
+		return s.Client.Registry.SetSilence(callback.Signature, "")
+
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownAction, callback.Action)
+	}
+}
+
+// resolvedSilences returns the silences of the recorded alerts the events
+// resolve, they have to be read before the events are recorded.
+func resolvedSilences(registry *Registry, events []MoogsoftEvent, alerts []PrometheusAlert) []string {
+	var silenceIDs []string
+	for i, event := range events {
+		if alerts[i].Status != "resolved" && event.Severity != CLEAR {
+			continue
+		}
+		if record, ok := registry.Get(event.Signature); ok && record.SilenceID != "" {
+			silenceIDs = append(silenceIDs, record.SilenceID)
+		}
+	}
+
+	return silenceIDs
+}
+
+// expire expires the silences of the resolved alerts, a nil silencer leaves
+// them until they end.
+func (s *Silencer) expire(ctx context.Context, silenceIDs []string) {
+	if s == nil {
+		return
+	}
+
+	logger := loggerFor(ctx)
+	for _, silenceID := range silenceIDs {
+		if err := s.expireSilence(ctx, silenceID); err != nil {
+			logger.Warn("Unable to expire alertmanager silence", "silence_id", silenceID, "error", err.Error())
+			continue
+		}
+		logger.Info("Expired alertmanager silence of resolved alert", "silence_id", silenceID)
+	}
+}
+
+func (s *Silencer) createSilence(ctx context.Context, alert PrometheusAlert, callback MoogsoftCallback) (string, error) {
+	now := time.Now().UTC()
+	silence := AlertmanagerSilence{
+		StartsAt:  now.Format(time.RFC3339Nano),
+		EndsAt:    now.Add(s.Duration).Format(time.RFC3339Nano),
+		CreatedBy: callback.User,
+		Comment:   callback.Comment,
+	}
+	if silence.CreatedBy == "" {
+		silence.CreatedBy = "moogsoft"
+	}
+	if silence.Comment == "" {
+		silence.Comment = fmt.Sprintf("Moogsoft %s of %s", callback.Action, callback.Signature)
+	}
+
+	for name, value := range alert.Labels {
+		silence.Matchers = append(silence.Matchers, AlertmanagerMatcher{Name: name, Value: value, IsEqual: true})
+	}
+
+	body, err := json.Marshal(silence)
+	if err != nil {
+		return "", err
+	}
+
+	var created struct {
+		SilenceID string `json:"silenceID"`
+	}
+
+	res, err := s.do(ctx, "POST", "/api/v2/silences", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+		return "", err
+	}
+
+	return created.SilenceID, nil
+}
+
+func (s *Silencer) expireSilence(ctx context.Context, silenceID string) error {
+	res, err := s.do(ctx, "DELETE", "/api/v2/silence/"+url.PathEscape(silenceID), nil)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	return nil
+}
+
+func (s *Silencer) do(ctx context.Context, method string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.AlertmanagerURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultAlertmanagerTimeout}
+	}
+
+	res, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 300 {
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+		return nil, fmt.Errorf("Alertmanager responded to %s %s with status code %d", method, path, res.StatusCode)
+	}
+
+	return res, nil
+}
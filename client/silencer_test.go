@@ -0,0 +1,116 @@
+package client_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("Silencer", func() {
+	var silencer *Silencer
+	var client *Client
+	var alertmanagerServer FakeAlertmanagerServer
+	var moogsoftServer FakeMoogsoftServer
+
+	signature := "ProbeUnsuccesful::someuri.com:8080"
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+		alertmanagerServer.Start()
+
+		client = &Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+			Registry:       NewRegistry(),
+		}
+		silencer = NewSilencer(alertmanagerServer.URL(), client, 2*time.Hour)
+
+		_, err := client.SendAlerts(context.Background(), []PrometheusAlert{{
+			Status:   "firing",
+			Labels:   map[string]string{"alertname": "ProbeUnsuccesful", "instance": "someuri.com:8080", "service": "probe", "severity": "warning"},
+			StartsAt: "2018-10-23T16:44:39.901211833Z",
+		}}, moogsoftServer.GetToken())
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+		alertmanagerServer.Stop()
+	})
+
+	Context("when an alert is acknowledged in moogsoft", func() {
+		It("Should silence it in alertmanager", func() {
+			Expect(silencer.Handle(context.Background(), MoogsoftCallback{Signature: signature, Action: "ack", User: "jdoe"})).Should(Succeed())
+
+			Expect(alertmanagerServer.Silences).Should(HaveLen(1))
+			silence := alertmanagerServer.Silences["silence-1"]
+			Expect(silence.CreatedBy).Should(Equal("jdoe"))
+			Expect(silence.Matchers).Should(ContainElement(AlertmanagerMatcher{Name: "instance", Value: "someuri.com:8080", IsEqual: true}))
+
+			record, _ := client.Registry.Get(signature)
+			Expect(record.SilenceID).Should(Equal("silence-1"))
+		})
+
+		It("Should not silence it twice", func() {
+			Expect(silencer.Handle(context.Background(), MoogsoftCallback{Signature: signature, Action: "ack"})).Should(Succeed())
+			Expect(silencer.Handle(context.Background(), MoogsoftCallback{Signature: signature, Action: "own"})).Should(Succeed())
+
+			Expect(alertmanagerServer.Silences).Should(HaveLen(1))
+		})
+
+		It("Should keep the silence when the alert is sent again", func() {
+			Expect(silencer.Handle(context.Background(), MoogsoftCallback{Signature: signature, Action: "ack"})).Should(Succeed())
+
+			_, err := client.SendAlerts(context.Background(), []PrometheusAlert{{
+				Status:   "firing",
+				Labels:   map[string]string{"alertname": "ProbeUnsuccesful", "instance": "someuri.com:8080", "service": "probe", "severity": "critical"},
+				StartsAt: "2018-10-23T16:44:39.901211833Z",
+			}}, moogsoftServer.GetToken())
+			Expect(err).ShouldNot(HaveOccurred())
+
+			record, _ := client.Registry.Get(signature)
+			Expect(record.SilenceID).Should(Equal("silence-1"))
+		})
+	})
+
+	Context("when an acknowledged alert is closed in moogsoft", func() {
+		It("Should expire its silence", func() {
+			Expect(silencer.Handle(context.Background(), MoogsoftCallback{Signature: signature, Action: "ack"})).Should(Succeed())
+			Expect(silencer.Handle(context.Background(), MoogsoftCallback{Signature: signature, Action: "close"})).Should(Succeed())
+
+			Expect(alertmanagerServer.Silences).Should(BeEmpty())
+			record, _ := client.Registry.Get(signature)
+			Expect(record.SilenceID).Should(BeEmpty())
+		})
+	})
+
+	Context("when an acknowledged alert resolves", func() {
+		It("Should expire its silence", func() {
+			client.Silencer = silencer
+			Expect(silencer.Handle(context.Background(), MoogsoftCallback{Signature: signature, Action: "ack"})).Should(Succeed())
+
+			_, err := client.SendAlerts(context.Background(), []PrometheusAlert{{
+				Status:   "resolved",
+				Labels:   map[string]string{"alertname": "ProbeUnsuccesful", "instance": "someuri.com:8080", "service": "probe", "severity": "warning"},
+				StartsAt: "2018-10-23T16:44:39.901211833Z",
+			}}, moogsoftServer.GetToken())
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Eventually(alertmanagerServer.SilenceCount).Should(BeZero())
+			_, ok := client.Registry.Get(signature)
+			Expect(ok).Should(BeFalse())
+		})
+	})
+
+	It("Should fail for unknown signatures", func() {
+		Expect(silencer.Handle(context.Background(), MoogsoftCallback{Signature: "unknown", Action: "ack"})).Should(MatchError(ErrUnknownSignature))
+	})
+
+	It("Should fail for unknown actions", func() {
+		Expect(silencer.Handle(context.Background(), MoogsoftCallback{Signature: signature, Action: "escalate"})).Should(MatchError(ContainSubstring("Unknown callback action")))
+	})
+})
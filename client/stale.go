@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StaleRule decides when an open alert that stopped being refreshed by
+// alertmanager is stale, and what is sent to moogsoft for it.
+type StaleRule struct {
+	// RepeatInterval is the alertmanager repeat_interval of the alert.
+	RepeatInterval time.Duration `yaml:"repeat_interval"`
+	// Multiplier is the number of repeat intervals without a refresh after
+	// which the alert is stale.
+	Multiplier float64 `yaml:"multiplier"`
+	// Action is clear to resolve the alert, stale to send it as
+	// INDETERMINATE or none to leave it alone.
+	Action string `yaml:"action"`
+}
+
+// StaleConfig holds the default rule and the per service overrides.
+type StaleConfig struct {
+	StaleRule     `yaml:",inline"`
+	CheckInterval time.Duration        `yaml:"check_interval"`
+	Services      map[string]StaleRule `yaml:"services"`
+}
+
+// Validate checks the actions of every rule.
+func (c StaleConfig) Validate() error {
+	rules := map[string]StaleRule{"default": c.StaleRule}
+	for service, rule := range c.Services {
+		rules[service] = rule
+	}
+
+	for name, rule := range rules {
+		switch rule.Action {
+		case "", "clear", "stale", "none":
+		default:
+			return fmt.Errorf("Invalid stale alerts action for %s: %s", name, rule.Action)
+		}
+	}
+
+	return nil
+}
+
+// RuleFor returns the rule of the service, falling back to the defaults for
+// the fields the service does not override.
+func (c StaleConfig) RuleFor(service string) StaleRule {
+	rule := c.StaleRule
+	override := c.Services[service]
+
+	if override.RepeatInterval > 0 {
+		rule.RepeatInterval = override.RepeatInterval
+	}
+	if override.Multiplier > 0 {
+		rule.Multiplier = override.Multiplier
+	}
+	if override.Action != "" {
+		rule.Action = override.Action
+	}
+	if rule.Multiplier <= 0 {
+		rule.Multiplier = 1
+	}
+	if rule.Action == "" {
+		rule.Action = "clear"
+	}
+
+	return rule
+}
+
+// StaleChecker resolves, or flags as stale, the open alerts alertmanager
+// stopped refreshing, e.g. because the prometheus raising them died.
+//
+// With an AlertmanagerURL an alert is refreshed when alertmanager last
+// updated it, whichever instance it notified. Alerts alertmanager does not
+// know, and every alert without an AlertmanagerURL, fall back to the last
+// time this instance sent them.
+type StaleChecker struct {
+	Client *Client
+	Token  string
+	Config StaleConfig
+
+	AlertmanagerURL string
+	// Receiver restricts the alertmanager alerts like the reconciler one.
+	Receiver   string
+	HTTPClient *http.Client
+}
+
+// Check sends the events for the alerts that are stale at now.
+func (s *StaleChecker) Check(ctx context.Context, now time.Time) error {
+	updatedAt, err := s.alertmanagerUpdates(ctx)
+	if err != nil {
+		return err
+	}
+
+	var alerts []PrometheusAlert
+
+	for _, record := range s.Client.Registry.Open() {
+		// The records hold the alerts as received, mapped after relabelling.
+		service := relabel(record.Alert, s.Client.Relabel).Labels["service"]
+		rule := s.Config.RuleFor(service)
+		if rule.Action == "none" || rule.RepeatInterval <= 0 || record.Alert.Status == "stale" || service == "heartbeat" {
+			continue
+		}
+
+		refreshedAt, ok := updatedAt[record.Signature]
+		if !ok {
+			refreshedAt = record.LastSent
+		}
+
+		maxAge := time.Duration(float64(rule.RepeatInterval) * rule.Multiplier)
+		if now.Sub(refreshedAt) <= maxAge {
+			continue
+		}
+
+		alert := record.Alert
+		alert.Annotations = map[string]string{}
+		for name, value := range record.Alert.Annotations {
+			alert.Annotations[name] = value
+		}
+		alert.Annotations["description"] = fmt.Sprintf("Stale alert, not refreshed for %s: %s", maxAge, alert.Annotations["description"])
+
+		if rule.Action == "clear" {
+			alert.Status = "resolved"
+		} else {
+			// Not a prometheus status, so it maps to INDETERMINATE.
+			alert.Status = "stale"
+		}
+
+		alerts = append(alerts, alert)
+	}
+
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	loggerFor(ctx).Info("Sending stale alerts", "alerts", len(alerts))
+
+	statusCode, err := s.Client.SendAlerts(ctx, alerts, s.Token)
+	if err != nil {
+		return err
+	}
+	if statusCode >= 400 {
+		return fmt.Errorf("Moogsoft responded with status code %d", statusCode)
+	}
+
+	return nil
+}
+
+// alertmanagerUpdates returns when alertmanager last updated its alerts, by
+// signature, or nothing without an AlertmanagerURL.
+func (s *StaleChecker) alertmanagerUpdates(ctx context.Context) (map[string]time.Time, error) {
+	updatedAt := map[string]time.Time{}
+	if s.AlertmanagerURL == "" {
+		return updatedAt, nil
+	}
+
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultAlertmanagerTimeout}
+	}
+
+	alertmanagerAlerts, err := fetchAlertmanagerAlerts(ctx, httpClient, strings.TrimSuffix(s.AlertmanagerURL, "/"), s.Receiver)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, alertmanagerAlert := range alertmanagerAlerts {
+		updated, err := time.Parse(time.RFC3339Nano, alertmanagerAlert.UpdatedAt)
+		if err != nil {
+			continue
+		}
+
+		signature := s.Client.signatureFor(PrometheusAlert{
+			Status:      "firing",
+			Labels:      alertmanagerAlert.Labels,
+			Annotations: alertmanagerAlert.Annotations,
+		})
+		if updated.After(updatedAt[signature]) {
+			updatedAt[signature] = updated
+		}
+	}
+
+	return updatedAt, nil
+}
+
+// Run checks for stale alerts every check interval until stop is closed.
+func (s *StaleChecker) Run(stop <-chan struct{}) {
+	interval := s.Config.CheckInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			ctx := WithRequestID(context.Background(), NewRequestID())
+			if err := s.Check(ctx, now); err != nil {
+				loggerFor(ctx).Error("Unable to send stale alerts", "error", err.Error())
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package client_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("StaleChecker", func() {
+	var checker *StaleChecker
+	var client *Client
+	var moogsoftServer FakeMoogsoftServer
+	var alertmanagerServer FakeAlertmanagerServer
+
+	sendFiring := func(service string) {
+		_, err := client.SendAlerts(context.Background(), []PrometheusAlert{{
+			Status:      "firing",
+			Labels:      map[string]string{"alertname": "ProbeUnsuccesful", "instance": "someuri.com:8080", "service": service, "severity": "warning"},
+			Annotations: map[string]string{"description": "probe failing"},
+			StartsAt:    "2018-10-23T16:44:39.901211833Z",
+		}}, moogsoftServer.GetToken())
+		Expect(err).ShouldNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		moogsoftServer.Start()
+		alertmanagerServer.Start()
+
+		client = &Client{
+			URL:            moogsoftServer.URL(),
+			EventsEndpoint: moogsoftServer.GetEventsEndpoint(),
+			Registry:       NewRegistry(),
+		}
+		checker = &StaleChecker{
+			Client: client,
+			Token:  moogsoftServer.GetToken(),
+			Config: StaleConfig{
+				StaleRule: StaleRule{RepeatInterval: time.Hour, Multiplier: 2},
+				Services: map[string]StaleRule{
+					"probe":      {Action: "stale"},
+					"prometheus": {Action: "none"},
+				},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		moogsoftServer.Stop()
+		alertmanagerServer.Stop()
+	})
+
+	Context("when an open alert was refreshed recently", func() {
+		It("Should leave it open", func() {
+			sendFiring("cf")
+
+			Expect(checker.Check(context.Background(), time.Now().Add(90*time.Minute))).Should(Succeed())
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+			Expect(client.Registry.Open()).Should(HaveLen(1))
+		})
+	})
+
+	Context("when an open alert was not refreshed for too long", func() {
+		It("Should clear it by default", func() {
+			sendFiring("cf")
+
+			Expect(checker.Check(context.Background(), time.Now().Add(3*time.Hour))).Should(Succeed())
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(2))
+			Expect(moogsoftServer.ReceivedEvents[1].Severity).Should(Equal(CLEAR))
+			Expect(moogsoftServer.ReceivedEvents[1].Description).Should(ContainSubstring("Stale alert"))
+			Expect(client.Registry.Open()).Should(BeEmpty())
+		})
+
+		It("Should flag it as stale once when the service action is stale", func() {
+			sendFiring("probe")
+
+			Expect(checker.Check(context.Background(), time.Now().Add(3*time.Hour))).Should(Succeed())
+			Expect(checker.Check(context.Background(), time.Now().Add(6*time.Hour))).Should(Succeed())
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(2))
+			Expect(moogsoftServer.ReceivedEvents[1].Severity).Should(Equal(INDETERMINATE))
+			Expect(client.Registry.Open()).Should(HaveLen(1))
+		})
+
+		It("Should leave it open when the service action is none", func() {
+			sendFiring("prometheus")
+
+			Expect(checker.Check(context.Background(), time.Now().Add(3*time.Hour))).Should(Succeed())
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+		})
+	})
+
+	Context("when alertmanager is set", func() {
+		BeforeEach(func() { checker.AlertmanagerURL = alertmanagerServer.URL() })
+
+		It("Should leave open the alerts alertmanager refreshed recently", func() {
+			sendFiring("cf")
+
+			now := time.Now().Add(3 * time.Hour)
+			alert := AlertmanagerAlert{
+				Labels:    map[string]string{"alertname": "ProbeUnsuccesful", "instance": "someuri.com:8080", "service": "cf", "severity": "warning"},
+				UpdatedAt: now.Add(-time.Minute).Format(time.RFC3339Nano),
+			}
+			alert.Status.State = "active"
+			alertmanagerServer.Alerts = []AlertmanagerAlert{alert}
+
+			Expect(checker.Check(context.Background(), now)).Should(Succeed())
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+			Expect(client.Registry.Open()).Should(HaveLen(1))
+		})
+
+		It("Should clear the alerts alertmanager stopped refreshing", func() {
+			sendFiring("cf")
+
+			now := time.Now().Add(3 * time.Hour)
+			alert := AlertmanagerAlert{
+				Labels:    map[string]string{"alertname": "ProbeUnsuccesful", "instance": "someuri.com:8080", "service": "cf", "severity": "warning"},
+				UpdatedAt: now.Add(-150 * time.Minute).Format(time.RFC3339Nano),
+			}
+			alert.Status.State = "active"
+			alertmanagerServer.Alerts = []AlertmanagerAlert{alert}
+
+			Expect(checker.Check(context.Background(), now)).Should(Succeed())
+
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(2))
+			Expect(moogsoftServer.ReceivedEvents[1].Severity).Should(Equal(CLEAR))
+		})
+
+		It("Should not send anything when alertmanager is not reachable", func() {
+			sendFiring("cf")
+			alertmanagerServer.Stop()
+
+			Expect(checker.Check(context.Background(), time.Now().Add(3*time.Hour))).ShouldNot(Succeed())
+			Expect(moogsoftServer.ReceivedEvents).Should(HaveLen(1))
+
+			alertmanagerServer.Start()
+		})
+	})
+
+	Describe("StaleConfig", func() {
+		It("Should reject unknown actions", func() {
+			config := StaleConfig{Services: map[string]StaleRule{"probe": {Action: "delete"}}}
+			Expect(config.Validate()).ShouldNot(Succeed())
+		})
+	})
+})
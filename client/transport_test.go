@@ -0,0 +1,120 @@
+package client_test
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+var _ = Describe("NewHTTPClient", func() {
+	var server *httptest.Server
+	var caFile string
+
+	BeforeEach(func() {
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		f, err := ioutil.TempFile("", "moogsoft-ca")
+		Expect(err).ShouldNot(HaveOccurred())
+		defer f.Close()
+
+		pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		caFile = f.Name()
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.Remove(caFile)
+	})
+
+	Context("when using a custom CA", func() {
+		It("Should trust the server certificate", func() {
+			httpClient, err := NewHTTPClient(HTTPConfig{CAFile: caFile, ConnectTimeout: time.Second})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			res, err := httpClient.Get(server.URL)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(res.StatusCode).Should(Equal(http.StatusOK))
+		})
+	})
+
+	Context("when not trusting the server CA", func() {
+		It("Should fail the request", func() {
+			httpClient, err := NewHTTPClient(HTTPConfig{})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			_, err = httpClient.Get(server.URL)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("Should allow skipping the verification", func() {
+			httpClient, err := NewHTTPClient(HTTPConfig{InsecureSkipVerify: true})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			_, err = httpClient.Get(server.URL)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("when the CA file is invalid", func() {
+		It("Should return an error", func() {
+			_, err := NewHTTPClient(HTTPConfig{CAFile: "/does/not/exist"})
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("when the client certificate can not be loaded", func() {
+		It("Should return an error", func() {
+			_, err := NewHTTPClient(HTTPConfig{CertFile: caFile})
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("when the request takes too long", func() {
+		It("Should give up after the request timeout", func() {
+			slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				time.Sleep(200 * time.Millisecond)
+			}))
+			defer slow.Close()
+
+			httpClient, err := NewHTTPClient(HTTPConfig{RequestTimeout: 50 * time.Millisecond})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			res, err := httpClient.Get(slow.URL)
+			if err == nil {
+				_, err = ioutil.ReadAll(res.Body)
+				res.Body.Close()
+			}
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("when using a proxy", func() {
+		It("Should send the requests through the proxy", func() {
+			var proxiedURL string
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				proxiedURL = r.URL.String()
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer proxy.Close()
+
+			httpClient, err := NewHTTPClient(HTTPConfig{ProxyURL: proxy.URL})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			_, err = httpClient.Get("http://moogsoft.example.com/events")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(proxiedURL).Should(Equal("http://moogsoft.example.com/events"))
+		})
+	})
+})
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io/ioutil"
+
+	p2mclient "github.com/bonzofenix/prometheus2moogsoft/client"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config holds the settings that do not fit in environment variables, loaded
+// from the yaml file given with --config.
+type Config struct {
+	GenericInputs []p2mclient.GenericInput   `yaml:"generic_inputs"`
+	StaleAlerts   *p2mclient.StaleConfig     `yaml:"stale_alerts"`
+	Heartbeats    *p2mclient.HeartbeatConfig `yaml:"heartbeats"`
+
+	MaintenanceWindows []p2mclient.MaintenanceWindow `yaml:"maintenance_windows"`
+
+	// Filters apply to every alert, DestinationFilters to the alerts sent to
+	// the moogsoft destination url and TenantFilters to the alerts whose
+	// TenantLabel has the tenant value.
+	Filters            *p2mclient.LabelFilter            `yaml:"filters"`
+	DestinationFilters map[string]*p2mclient.LabelFilter `yaml:"destination_filters"`
+	TenantLabel        string                            `yaml:"tenant_label"`
+	TenantFilters      map[string]*p2mclient.LabelFilter `yaml:"tenant_filters"`
+
+	RelabelConfigs  []p2mclient.RelabelConfig    `yaml:"relabel_configs"`
+	LookupTables    []*p2mclient.LookupTable     `yaml:"lookup_tables"`
+	HTTPEnrichments []*p2mclient.HTTPEnrichment  `yaml:"http_enrichments"`
+	IPAddress       *p2mclient.IPConfig          `yaml:"ip_address"`
+	MetricValue     *p2mclient.MetricConfig      `yaml:"metric_value"`
+	Description     *p2mclient.DescriptionConfig `yaml:"description"`
+	CustomInfo      *p2mclient.CustomInfoConfig  `yaml:"custom_info"`
+}
+
+// loadConfig reads the config file, returning its raw content along with the
+// parsed config. An empty path returns an empty config.
+func loadConfig(path string) (Config, []byte, error) {
+	var config Config
+
+	if path == "" {
+		return config, nil, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(content, &config); err != nil {
+		return config, nil, err
+	}
+
+	if err := p2mclient.ValidateGenericInputs(config.GenericInputs); err != nil {
+		return config, nil, err
+	}
+
+	if config.StaleAlerts != nil {
+		if err := config.StaleAlerts.Validate(); err != nil {
+			return config, nil, err
+		}
+	}
+
+	for i := range config.MaintenanceWindows {
+		if err := config.MaintenanceWindows[i].Validate(); err != nil {
+			return config, nil, err
+		}
+	}
+
+	for i := range config.RelabelConfigs {
+		if err := config.RelabelConfigs[i].Validate(); err != nil {
+			return config, nil, err
+		}
+	}
+
+	for _, table := range config.LookupTables {
+		if err := table.Validate(); err != nil {
+			return config, nil, err
+		}
+	}
+
+	for _, enrichment := range config.HTTPEnrichments {
+		if err := enrichment.Validate(); err != nil {
+			return config, nil, err
+		}
+	}
+
+	if config.IPAddress != nil {
+		if err := config.IPAddress.Validate(); err != nil {
+			return config, nil, err
+		}
+	}
+
+	if config.Description != nil {
+		if err := config.Description.Validate(); err != nil {
+			return config, nil, err
+		}
+	}
+
+	filters := []*p2mclient.LabelFilter{config.Filters}
+	for _, filter := range config.DestinationFilters {
+		filters = append(filters, filter)
+	}
+	for _, filter := range config.TenantFilters {
+		filters = append(filters, filter)
+	}
+	for _, filter := range filters {
+		if filter == nil {
+			continue
+		}
+		if err := filter.Validate(); err != nil {
+			return config, nil, err
+		}
+	}
+
+	if config.Heartbeats != nil {
+		if err := config.Heartbeats.Validate(); err != nil {
+			return config, nil, err
+		}
+	}
+
+	return config, content, nil
+}
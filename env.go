@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configPrefixes are the prefixes of the environment variables configuring
+// the app.
+var configPrefixes = []string{"MOOGSOFT_", "XMATTERS_", "LOG_", "PROMETHEUS_", "ALERTMANAGER_", "RECONCILE_", "REGISTRY_", "DEBUG"}
+
+// secretSettings are the environment variables holding secrets. Only whether
+// they are set goes into the config checksum, never their value.
+var secretSettings = map[string]bool{
+	"MOOGSOFT_TOKEN":          true,
+	"MOOGSOFT_USERNAME":       true,
+	"MOOGSOFT_PASSWORD":       true,
+	"MOOGSOFT_CALLBACK_TOKEN": true,
+	"MAINTENANCE_TOKEN":       true,
+}
+
+// The env helpers return the default value when the variable is not set and
+// exit when it can not be parsed.
+
+func envInt(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(value)
+	exitOnInvalidEnv(name, err)
+
+	return i
+}
+
+func envFloat(name string, defaultValue float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	exitOnInvalidEnv(name, err)
+
+	return f
+}
+
+func envBool(name string, defaultValue bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(value)
+	exitOnInvalidEnv(name, err)
+
+	return b
+}
+
+func envDuration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	exitOnInvalidEnv(name, err)
+
+	return d
+}
+
+func envList(name string) []string {
+	var values []string
+
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// firstInstance reports whether the app runs as its first instance, the only
+// one running the tasks whose state is kept by each instance.
+func firstInstance() bool {
+	instanceIndex := os.Getenv("CF_INSTANCE_INDEX")
+	return instanceIndex == "" || instanceIndex == "0"
+}
+
+func exitOnInvalidEnv(name string, err error) {
+	if err != nil {
+		exitOnError(fmt.Errorf("Invalid %s: %s", name, err.Error()))
+	}
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(3)
+	}
+}
+
+// configChecksum returns a checksum of the config file and the environment
+// variables configuring the app, so instances running with different settings
+// can be told apart. Secrets are hashed by name only so the checksum can not
+// be used to guess them.
+func configChecksum(rawConfig []byte) string {
+	var settings []string
+
+	for _, setting := range os.Environ() {
+		if name := strings.SplitN(setting, "=", 2)[0]; secretSettings[name] {
+			setting = name
+		}
+
+		for _, prefix := range configPrefixes {
+			if strings.HasPrefix(setting, prefix) {
+				settings = append(settings, setting)
+				break
+			}
+		}
+	}
+	sort.Strings(settings)
+
+	settings = append(settings, string(rawConfig))
+
+	sum := sha256.Sum256([]byte(strings.Join(settings, "\n")))
+	return hex.EncodeToString(sum[:])
+}
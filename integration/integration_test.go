@@ -2,12 +2,15 @@ package integration_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"os/exec"
+	"time"
 
 	"github.com/bonzofenix/prometheus2moogsoft/client"
 	. "github.com/onsi/ginkgo"
@@ -35,7 +38,7 @@ var _ = Describe("Prometheus2Moogsoft", func() {
 
 	AfterEach(func() {
 		moogsoftServer.Stop()
-		session.Kill()
+		Eventually(session.Kill()).Should(gexec.Exit())
 	})
 
 	JustBeforeEach(func() {
@@ -48,13 +51,122 @@ var _ = Describe("Prometheus2Moogsoft", func() {
 
 		It("return moogsoft url and event endpoint", func() {
 			body := GET("http://localhost:3000/info")
-			Expect(body).ShouldNot(BeNil())
+			config := GETJSON("http://localhost:3000/info")["config"].(map[string]interface{})
+
 			Expect(body).Should(MatchJSON(fmt.Sprintf(`{
+        "version": "dev",
+        "commit": "unknown",
+        "config": { "checksum": %q, "loaded_at": %q },
+        "mapping_rules": 7,
+        "open_alerts": 0,
+        "destinations": [
+          {
+            "url": "%[3]s",
+            "events_endpoint": "/custom_moogsoft_events",
+            "circuit_breaker": "disabled",
+            "queue_depth": 0,
+            "dead_letters": 0,
+            "last_success": null,
+            "last_failure": null,
+            "last_error": ""
+          }
+        ],
         "moogsoft_events_endpoint": "/custom_moogsoft_events",
+        "circuit_breaker": "disabled",
+        "moogsoft_credentials": { "MOOGSOFT_TOKEN": "env" },
         "moogsoft_token": "[REDACTED]",
-        "moogsoft_url": "%s"
-      }`, moogsoftServer.URL())))
+        "moogsoft_url": "%[3]s"
+      }`, config["checksum"], config["loaded_at"], moogsoftServer.URL())))
+		})
+
+		It("return a config checksum that ignores secret values", func() {
+			checksum := GETJSON("http://localhost:3000/info")["config"].(map[string]interface{})["checksum"]
+			Expect(checksum).Should(MatchRegexp("^[0-9a-f]{64}$"))
+
+			Eventually(session.Kill()).Should(gexec.Exit())
+			os.Setenv("MOOGSOFT_TOKEN", "another-token")
+			session, err = gexec.Start(exec.Command(prometheusToMoogsoftPath, "-p 3000"), GinkgoWriter, GinkgoWriter)
+			Expect(err).ShouldNot(HaveOccurred())
+			Eventually(serverIsRunning, "2s").Should(BeTrue())
+
+			Expect(GETJSON("http://localhost:3000/info")["config"]).Should(HaveKeyWithValue("checksum", checksum))
+		})
+
+		Context("after delivering events", func() {
+			It("return the last successful delivery", func() {
+				prometheusPayload, err = ioutil.ReadFile(AssetPathFor("supported_alerts.json"))
+				Expect(err).ShouldNot(HaveOccurred())
+				POST("http://localhost:3000/prometheus_webhook_event", prometheusPayload)
+
+				destination := GETJSON("http://localhost:3000/info")["destinations"].([]interface{})[0]
+				Expect(destination).Should(HaveKeyWithValue("last_success", Not(BeNil())))
+			})
+		})
+	})
+
+	Context("GET /-/healthy", func() {
+		JustBeforeEach(func() { Eventually(serverIsRunning, "2s").Should(BeTrue()) })
+
+		It("return healthy", func() {
+			Expect(GET("http://localhost:3000/-/healthy")).Should(Equal("healthy"))
+		})
+	})
+
+	Context("GET /-/ready", func() {
+		JustBeforeEach(func() { Eventually(serverIsRunning, "2s").Should(BeTrue()) })
+
+		It("return ready when moogsoft is reachable", func() {
+			Expect(GET("http://localhost:3000/-/ready")).Should(MatchJSON(`{"status": "ready"}`))
+		})
+
+		Context("when moogsoft is failing", func() {
+			BeforeEach(func() {
+				os.Setenv("MOOGSOFT_BREAKER_THRESHOLD", "1")
+				moogsoftServer.FailWith = http.StatusBadGateway
+			})
+
+			AfterEach(func() { os.Unsetenv("MOOGSOFT_BREAKER_THRESHOLD") })
+
+			It("stays ready and reports the breaker on /metrics", func() {
+				prometheusPayload, err = ioutil.ReadFile(AssetPathFor("supported_alerts.json"))
+				Expect(err).ShouldNot(HaveOccurred())
+
+				POST("http://localhost:3000/prometheus_webhook_event", prometheusPayload)
+				Expect(GET("http://localhost:3000/-/ready")).Should(MatchJSON(`{"status": "ready"}`))
+				Expect(GET("http://localhost:3000/metrics")).Should(ContainSubstring("prometheus2moogsoft_circuit_breaker_state"))
+			})
+
+			Context("and the circuit breaker check is enabled", func() {
+				BeforeEach(func() { os.Setenv("READY_CHECK_CIRCUIT_BREAKER", "true") })
+
+				AfterEach(func() { os.Unsetenv("READY_CHECK_CIRCUIT_BREAKER") })
+
+				It("return not ready", func() {
+					prometheusPayload, err = ioutil.ReadFile(AssetPathFor("supported_alerts.json"))
+					Expect(err).ShouldNot(HaveOccurred())
+
+					POST("http://localhost:3000/prometheus_webhook_event", prometheusPayload)
+					body := GET("http://localhost:3000/-/ready")
+					Expect(body).Should(ContainSubstring(`"status":"not ready"`))
+					Expect(body).Should(ContainSubstring("circuit breaker is open"))
+				})
+			})
+
+			Context("and the retry queue is full", func() {
+				BeforeEach(func() { os.Setenv("MOOGSOFT_RETRY_QUEUE_SIZE", "1") })
+
+				AfterEach(func() { os.Unsetenv("MOOGSOFT_RETRY_QUEUE_SIZE") })
 
+				It("return not ready", func() {
+					prometheusPayload, err = ioutil.ReadFile(AssetPathFor("supported_alerts.json"))
+					Expect(err).ShouldNot(HaveOccurred())
+
+					POST("http://localhost:3000/prometheus_webhook_event", prometheusPayload)
+					body := GET("http://localhost:3000/-/ready")
+					Expect(body).Should(ContainSubstring(`"status":"not ready"`))
+					Expect(body).Should(ContainSubstring("retry queue is full"))
+				})
+			})
 		})
 	})
 
@@ -86,6 +198,158 @@ var _ = Describe("Prometheus2Moogsoft", func() {
 		})
 	})
 
+	Context("GET /alerts", func() {
+		JustBeforeEach(func() {
+			prometheusPayload, err = ioutil.ReadFile(AssetPathFor("supported_alerts.json"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Eventually(serverIsRunning, "2s").Should(BeTrue())
+
+			POST("http://localhost:3000/prometheus_webhook_event", prometheusPayload)
+		})
+
+		It("return the alerts open in moogsoft", func() {
+			var records []client.AlertRecord
+			Expect(json.Unmarshal([]byte(GET("http://localhost:3000/alerts")), &records)).Should(Succeed())
+			Expect(records).Should(HaveLen(2))
+		})
+
+		It("return the alerts matching the filters", func() {
+			var records []client.AlertRecord
+			Expect(json.Unmarshal([]byte(GET("http://localhost:3000/alerts?label=service=prometheus&severity=MAJOR")), &records)).Should(Succeed())
+			Expect(records).Should(HaveLen(1))
+			Expect(records[0].Signature).Should(Equal("PrometheusScrapeError::concourse::concourse"))
+		})
+	})
+
+	Context("/maintenance_windows", func() {
+		window := func() []byte {
+			return []byte(fmt.Sprintf(`{
+        "name": "concourse-upgrade",
+        "matchers": { "bosh_deployment": "concourse" },
+        "starts_at": %q,
+        "ends_at": %q,
+        "action": "drop"
+      }`, time.Now().Add(-time.Hour).Format(time.RFC3339), time.Now().Add(time.Hour).Format(time.RFC3339)))
+		}
+
+		BeforeEach(func() { os.Setenv("MAINTENANCE_TOKEN", "maintenance-token") })
+
+		AfterEach(func() { os.Unsetenv("MAINTENANCE_TOKEN") })
+
+		JustBeforeEach(func() {
+			prometheusPayload, err = ioutil.ReadFile(AssetPathFor("supported_alerts.json"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Eventually(serverIsRunning, "2s").Should(BeTrue())
+
+			Expect(requestWithToken("POST", "http://localhost:3000/maintenance_windows", window(), "maintenance-token").StatusCode).Should(Equal(http.StatusCreated))
+		})
+
+		It("Should list the windows", func() {
+			var windows []client.MaintenanceWindow
+			Expect(json.Unmarshal([]byte(GET("http://localhost:3000/maintenance_windows")), &windows)).Should(Succeed())
+			Expect(windows).Should(HaveLen(1))
+			Expect(windows[0].Name).Should(Equal("concourse-upgrade"))
+		})
+
+		It("Should drop the alerts in maintenance", func() {
+			POST("http://localhost:3000/prometheus_webhook_event", prometheusPayload)
+			Eventually(moogsoftServer.ReceivedEvents, "2s").Should(HaveLen(1))
+		})
+
+		It("Should remove the windows", func() {
+			Expect(requestWithToken("DELETE", "http://localhost:3000/maintenance_windows/concourse-upgrade", nil, "maintenance-token").StatusCode).Should(Equal(http.StatusNoContent))
+
+			POST("http://localhost:3000/prometheus_webhook_event", prometheusPayload)
+			Eventually(moogsoftServer.ReceivedEvents, "2s").Should(HaveLen(2))
+		})
+
+		It("Should reject changes without the maintenance token", func() {
+			Expect(requestWithToken("POST", "http://localhost:3000/maintenance_windows", window(), "wrong-token").StatusCode).Should(Equal(http.StatusUnauthorized))
+			Expect(requestWithToken("DELETE", "http://localhost:3000/maintenance_windows/concourse-upgrade", nil, "").StatusCode).Should(Equal(http.StatusUnauthorized))
+
+			var windows []client.MaintenanceWindow
+			Expect(json.Unmarshal([]byte(GET("http://localhost:3000/maintenance_windows")), &windows)).Should(Succeed())
+			Expect(windows).Should(HaveLen(1))
+		})
+	})
+
+	Context("POST /moogsoft_callback", func() {
+		callback := []byte(`{ "signature": "ProbeUnsuccesful::someuri.com:8080", "action": "ack" }`)
+
+		BeforeEach(func() { os.Setenv("ALERTMANAGER_URL", "http://localhost:9093") })
+
+		AfterEach(func() { os.Unsetenv("ALERTMANAGER_URL") })
+
+		JustBeforeEach(func() { Eventually(serverIsRunning, "2s").Should(BeTrue()) })
+
+		It("Should not be served by default", func() {
+			Expect(requestWithToken("POST", "http://localhost:3000/moogsoft_callback", callback, "").StatusCode).Should(Equal(http.StatusNotFound))
+		})
+
+		Context("when the callbacks are enabled", func() {
+			BeforeEach(func() {
+				os.Setenv("MOOGSOFT_CALLBACK_ENABLED", "true")
+				os.Setenv("MOOGSOFT_CALLBACK_TOKEN", "callback-token")
+			})
+
+			AfterEach(func() {
+				os.Unsetenv("MOOGSOFT_CALLBACK_ENABLED")
+				os.Unsetenv("MOOGSOFT_CALLBACK_TOKEN")
+			})
+
+			It("Should reject callbacks without the callback token", func() {
+				Expect(requestWithToken("POST", "http://localhost:3000/moogsoft_callback", callback, "wrong-token").StatusCode).Should(Equal(http.StatusUnauthorized))
+			})
+
+			Context("and the app is not the first instance", func() {
+				BeforeEach(func() { os.Setenv("CF_INSTANCE_INDEX", "1") })
+
+				AfterEach(func() { os.Unsetenv("CF_INSTANCE_INDEX") })
+
+				It("Should leave the callbacks to the first instance", func() {
+					Expect(requestWithToken("POST", "http://localhost:3000/moogsoft_callback", callback, "callback-token").StatusCode).Should(Equal(http.StatusServiceUnavailable))
+				})
+			})
+		})
+	})
+
+	Context("POST /grafana_webhook_event", func() {
+		JustBeforeEach(func() {
+			prometheusPayload, err = ioutil.ReadFile(AssetPathFor("grafana_alerts.json"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Eventually(serverIsRunning, "2s").Should(BeTrue())
+		})
+
+		It("Should send alert to moogsoft", func() {
+			POST("http://localhost:3000/grafana_webhook_event", prometheusPayload)
+			Eventually(moogsoftServer.ReceivedEvents, "2s").Should(HaveLen(1))
+		})
+	})
+
+	Context("POST /generic_webhook_event/:name", func() {
+		BeforeEach(func() {
+			prometheusToMoogsoftCmd = exec.Command(prometheusToMoogsoftPath, "-p 3000", "-c", AssetPathFor("config.yml"))
+		})
+
+		JustBeforeEach(func() { Eventually(serverIsRunning, "2s").Should(BeTrue()) })
+
+		It("Should send the alerts extracted by the input to moogsoft", func() {
+			POST("http://localhost:3000/generic_webhook_event/checker", []byte(`{
+        "results": [
+          { "state": "CRITICAL", "check": "HttpCheck", "host": "someuri.com", "port": 8080, "output": "connection refused", "timestamp": 1540313079 }
+        ]
+      }`))
+			Eventually(moogsoftServer.ReceivedEvents, "2s").Should(HaveLen(1))
+			Expect(moogsoftServer.ReceivedEvents[0].Signature).Should(Equal("HttpCheck::someuri.com:8080"))
+		})
+
+		It("Should return not found for unknown inputs", func() {
+			res, err := http.Post("http://localhost:3000/generic_webhook_event/unknown", "application/json", bytes.NewReader([]byte("{}")))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(res.StatusCode).Should(Equal(http.StatusNotFound))
+		})
+	})
+
 	//Context("When moogsoft returns an error", func() {
 	//	BeforeEach(func() {
 	//		prometheusToMoogsoftCmd = exec.Command(prometheusToMoogsoftPath, "-p 3000")
@@ -119,6 +383,21 @@ func POST(uri string, rawData []byte) string {
 	return string(body)
 }
 
+func requestWithToken(method string, uri string, rawData []byte, token string) *http.Response {
+	req, err := http.NewRequest(method, uri, bytes.NewReader(rawData))
+	Expect(err).ShouldNot(HaveOccurred())
+
+	req.Close = true
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := http.DefaultClient.Do(req)
+	Expect(err).ShouldNot(HaveOccurred())
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	return res
+}
+
 func GET(uri string) string {
 	res, err := http.Get(uri)
 	Expect(err).ShouldNot(HaveOccurred())
@@ -128,6 +407,13 @@ func GET(uri string) string {
 	return string(body)
 }
 
+func GETJSON(uri string) map[string]interface{} {
+	var body map[string]interface{}
+	Expect(json.Unmarshal([]byte(GET(uri)), &body)).Should(Succeed())
+
+	return body
+}
+
 func serverIsRunning() bool {
 	_, err := net.Dial("tcp", "localhost:3000")
 	return err == nil
@@ -1,70 +1,463 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/bonzofenix/prometheus2moogsoft/client"
+	p2mclient "github.com/bonzofenix/prometheus2moogsoft/client"
+	"github.com/bonzofenix/prometheus2moogsoft/secrets"
 	"github.com/gin-gonic/gin"
 	flags "github.com/jessevdk/go-flags"
 )
 
 type Options struct {
-	Port string `short:"p" long:"prefix" description:"Port where app will be running." optional:"true"`
+	Port       string `short:"p" long:"prefix" description:"Port where app will be running." optional:"true"`
+	ConfigFile string `short:"c" long:"config" description:"Path to the yaml config file." env:"CONFIG_FILE"`
 }
 
 var opts Options
 
+// Set at build time with -ldflags "-X main.version=... -X main.commit=...".
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
 func main() {
 	if _, err := flags.Parse(&opts); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(3)
 	}
 
-	log.SetOutput(os.Stdout)
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel()})))
 	gin.SetMode(gin.ReleaseMode)
 
-	p2mServer := gin.Default()
+	p2mServer := gin.New()
+	p2mServer.Use(requestLogger(), gin.Recovery())
 
 	if opts.Port == "" {
 		opts.Port = os.Getenv("PORT")
 	}
 
-	client := client.Client{
+	config, rawConfig, err := loadConfig(opts.ConfigFile)
+	exitOnError(err)
+
+	client := p2mclient.Client{
 		Env:               os.Getenv("MOOGSOFT_ENV"),
 		URL:               os.Getenv("MOOGSOFT_URL"),
 		EventsEndpoint:    os.Getenv("MOOGSOFT_ENDPOINT"),
 		XMattersGroupName: os.Getenv("XMATTERS_GROUP_NAME"),
+		RedactKeys:        envList("LOG_REDACT_KEYS"),
+	}
+
+	if registryPath := os.Getenv("REGISTRY_PATH"); registryPath != "" {
+		client.Registry, err = p2mclient.OpenRegistry(registryPath)
+		exitOnError(err)
+	} else {
+		client.Registry = p2mclient.NewRegistry()
+	}
+
+	httpClient, err := p2mclient.NewHTTPClient(p2mclient.HTTPConfig{
+		ConnectTimeout:     envDuration("MOOGSOFT_CONNECT_TIMEOUT", 5*time.Second),
+		ResponseTimeout:    envDuration("MOOGSOFT_RESPONSE_TIMEOUT", 30*time.Second),
+		RequestTimeout:     envDuration("MOOGSOFT_REQUEST_TIMEOUT", time.Minute),
+		MaxIdleConns:       envInt("MOOGSOFT_MAX_IDLE_CONNS", 10),
+		CAFile:             os.Getenv("MOOGSOFT_CA_FILE"),
+		CertFile:           os.Getenv("MOOGSOFT_CLIENT_CERT_FILE"),
+		KeyFile:            os.Getenv("MOOGSOFT_CLIENT_KEY_FILE"),
+		InsecureSkipVerify: envBool("MOOGSOFT_INSECURE_SKIP_VERIFY", false),
+		ProxyURL:           os.Getenv("MOOGSOFT_PROXY_URL"),
+	})
+	exitOnError(err)
+	client.HTTPClient = httpClient
+
+	serviceName := os.Getenv("MOOGSOFT_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "moogsoft"
+	}
+
+	resolver, err := secrets.NewResolver(serviceName)
+	exitOnError(err)
+
+	credentialSources := map[string]string{}
+	client.Auth = newAuthenticator(os.Getenv("MOOGSOFT_AUTH_MODE"), func(name string) p2mclient.Credential {
+		credential, source := resolver.Resolve(name)
+		credentialSources[name] = source
+		return credential
+	})
+
+	rateLimit := envFloat("MOOGSOFT_RATE_LIMIT", 0)
+	maxConcurrency := envInt("MOOGSOFT_MAX_CONCURRENCY", 0)
+	if rateLimit > 0 || maxConcurrency > 0 {
+		client.Limiter = p2mclient.NewRateLimiter(rateLimit, envInt("MOOGSOFT_RATE_BURST", 1), maxConcurrency)
+	}
+
+	if breakerThreshold := envInt("MOOGSOFT_BREAKER_THRESHOLD", 0); breakerThreshold > 0 {
+		client.Breaker = p2mclient.NewCircuitBreaker(breakerThreshold, envDuration("MOOGSOFT_BREAKER_COOLDOWN", 30*time.Second))
+	}
+
+	if retryQueueSize := envInt("MOOGSOFT_RETRY_QUEUE_SIZE", 0); retryQueueSize > 0 {
+		client.Queue = p2mclient.NewRetryQueue(retryQueueSize, envInt("MOOGSOFT_RETRY_MAX_ATTEMPTS", 0))
+		go client.RunRetries(envDuration("MOOGSOFT_RETRY_INTERVAL", 10*time.Second), make(chan struct{}))
 	}
 
 	token := os.Getenv("MOOGSOFT_TOKEN")
 	redactedToken := ""
-	if token != "" {
+	if source, ok := credentialSources["MOOGSOFT_TOKEN"]; ok && source != secrets.SourceNone {
 		redactedToken = "[REDACTED]"
 	}
 
+	if prometheusURL := os.Getenv("PROMETHEUS_URL"); prometheusURL != "" {
+		// Every instance would send the same transitions to moogsoft.
+		if !firstInstance() {
+			slog.Info("Not polling prometheus, only the first instance does", "instance_index", os.Getenv("CF_INSTANCE_INDEX"))
+		} else {
+			poller := p2mclient.NewPrometheusPoller(prometheusURL, &client, token)
+			poller.HTTPClient = &http.Client{Timeout: envDuration("PROMETHEUS_TIMEOUT", 10*time.Second)}
+			go poller.Run(envDuration("PROMETHEUS_POLL_INTERVAL", 30*time.Second), make(chan struct{}))
+		}
+	}
+
+	if alertmanagerURL := os.Getenv("ALERTMANAGER_URL"); alertmanagerURL != "" {
+		// The registry only holds the alerts delivered by this instance, the
+		// other instances would resend and resolve each other's alerts.
+		if !firstInstance() {
+			slog.Info("Not reconciling with alertmanager, only the first instance does", "instance_index", os.Getenv("CF_INSTANCE_INDEX"))
+		} else {
+			reconciler := p2mclient.NewReconciler(alertmanagerURL, &client, token)
+			reconciler.Receiver = os.Getenv("ALERTMANAGER_RECEIVER")
+			reconciler.HTTPClient = &http.Client{Timeout: envDuration("ALERTMANAGER_TIMEOUT", 10*time.Second)}
+			go reconciler.Run(envDuration("RECONCILE_INTERVAL", 5*time.Minute), make(chan struct{}))
+		}
+	}
+
+	if config.StaleAlerts != nil {
+		staleChecker := p2mclient.StaleChecker{
+			Client:          &client,
+			Token:           token,
+			Config:          *config.StaleAlerts,
+			AlertmanagerURL: os.Getenv("ALERTMANAGER_URL"),
+			Receiver:        os.Getenv("ALERTMANAGER_RECEIVER"),
+			HTTPClient:      &http.Client{Timeout: envDuration("ALERTMANAGER_TIMEOUT", 10*time.Second)},
+		}
+		go staleChecker.Run(make(chan struct{}))
+	}
+
+	if config.Heartbeats != nil && len(config.Heartbeats.Alerts) > 0 {
+		client.Heartbeats = p2mclient.NewHeartbeatMonitor(config.Heartbeats.Alerts)
+		client.Heartbeats.AlertmanagerURL = os.Getenv("ALERTMANAGER_URL")
+		client.Heartbeats.Receiver = os.Getenv("ALERTMANAGER_RECEIVER")
+		client.Heartbeats.HTTPClient = &http.Client{Timeout: envDuration("ALERTMANAGER_TIMEOUT", 10*time.Second)}
+
+		// Every instance would send the missing heartbeat events.
+		if !firstInstance() {
+			slog.Info("Not checking heartbeats, only the first instance does", "instance_index", os.Getenv("CF_INSTANCE_INDEX"))
+		} else {
+			checkInterval := config.Heartbeats.CheckInterval
+			if checkInterval <= 0 {
+				checkInterval = 30 * time.Second
+			}
+			go client.RunHeartbeats(checkInterval, token, make(chan struct{}))
+		}
+	}
+
+	client.Relabel = config.RelabelConfigs
+	client.Lookups = config.LookupTables
+	client.Enrichments = config.HTTPEnrichments
+	client.IP = config.IPAddress
+	client.Metrics = config.MetricValue
+	client.Description = config.Description
+	client.CustomInfo = config.CustomInfo
+	client.Filters = []*p2mclient.LabelFilter{config.Filters, config.DestinationFilters[client.Destination()]}
+	client.TenantLabel = config.TenantLabel
+	client.TenantFilters = config.TenantFilters
+
+	if maintenancePath := os.Getenv("MAINTENANCE_PATH"); maintenancePath != "" {
+		client.Maintenance, err = p2mclient.OpenMaintenanceSchedule(maintenancePath)
+		exitOnError(err)
+	} else {
+		client.Maintenance = p2mclient.NewMaintenanceSchedule()
+	}
+	for _, window := range config.MaintenanceWindows {
+		exitOnError(client.Maintenance.AddConfigured(window))
+	}
+
+	checksum := configChecksum(rawConfig)
+	loadedAt := time.Now()
+
 	p2mServer.GET("/info", func(c *gin.Context) {
+		status := client.Status()
+
 		c.JSON(200, gin.H{
+			"version":                  version,
+			"commit":                   commit,
+			"config":                   gin.H{"checksum": checksum, "loaded_at": loadedAt},
+			"mapping_rules":            p2mclient.MappingRules(),
+			"open_alerts":              client.Registry.Len(),
+			"destinations":             []p2mclient.DestinationStatus{status},
 			"moogsoft_url":             client.URL,
 			"moogsoft_events_endpoint": client.EventsEndpoint,
 			"moogsoft_token":           redactedToken,
+			"moogsoft_credentials":     credentialSources,
+			"circuit_breaker":          status.CircuitBreaker,
 		})
 	})
 
-	p2mServer.POST("/prometheus_webhook_event", func(c *gin.Context) {
+	p2mServer.GET("/-/healthy", func(c *gin.Context) {
+		c.String(200, "healthy")
+	})
+
+	readinessChecks := p2mclient.ReadinessChecks{
+		CircuitBreaker: envBool("READY_CHECK_CIRCUIT_BREAKER", false),
+		MaxDeliveryAge: envDuration("READY_MAX_DELIVERY_AGE", 0),
+	}
+
+	p2mServer.GET("/-/ready", func(c *gin.Context) {
+		if reasons := client.NotReadyReasons(readinessChecks); len(reasons) > 0 {
+			c.JSON(503, gin.H{"status": "not ready", "reasons": reasons})
+			return
+		}
+
+		c.JSON(200, gin.H{"status": "ready"})
+	})
+
+	p2mServer.GET("/metrics", func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4")
+		client.WriteMetrics(c.Writer)
+	})
+
+	p2mServer.GET("/alerts", func(c *gin.Context) {
+		filter := p2mclient.RegistryFilter{
+			Signature:   c.Query("signature"),
+			Destination: c.Query("destination"),
+			Labels:      map[string]string{},
+		}
+
+		if c.Query("severity") != "" {
+			severity, err := p2mclient.ParseSeverity(c.Query("severity"))
+			if err != nil {
+				c.String(400, err.Error())
+				return
+			}
+			filter.Severity = &severity
+		}
+
+		for _, label := range c.QueryArray("label") {
+			parts := strings.SplitN(label, "=", 2)
+			if len(parts) != 2 {
+				c.String(400, fmt.Sprintf("Invalid label filter %q, expected name=value", label))
+				return
+			}
+			filter.Labels[parts[0]] = parts[1]
+		}
+
+		c.JSON(200, client.Registry.Query(filter))
+	})
+
+	p2mServer.GET("/maintenance_windows", func(c *gin.Context) {
+		c.JSON(200, client.Maintenance.List())
+	})
+
+	// Changing the windows requires MAINTENANCE_TOKEN, without it they are
+	// only set from the config file.
+	if maintenanceToken := os.Getenv("MAINTENANCE_TOKEN"); maintenanceToken != "" {
+		maintenanceAPI := p2mServer.Group("/maintenance_windows", requireBearerToken(maintenanceToken))
+
+		maintenanceAPI.POST("", func(c *gin.Context) {
+			var window p2mclient.MaintenanceWindow
+			if err := c.BindJSON(&window); err != nil {
+				return
+			}
+
+			err := client.Maintenance.Add(window)
+			switch {
+			case errors.Is(err, p2mclient.ErrConfiguredWindow):
+				c.String(409, err.Error())
+				return
+			case err != nil:
+				c.String(400, err.Error())
+				return
+			}
+
+			c.JSON(201, window)
+		})
+
+		maintenanceAPI.DELETE("/:name", func(c *gin.Context) {
+			removed, err := client.Maintenance.Remove(c.Param("name"))
+			switch {
+			case errors.Is(err, p2mclient.ErrConfiguredWindow):
+				c.String(409, err.Error())
+			case err != nil:
+				c.String(500, err.Error())
+			case !removed:
+				c.String(404, fmt.Sprintf("Unknown maintenance window: %s", c.Param("name")))
+			default:
+				c.Status(204)
+			}
+		})
+	}
+
+	p2mServer.POST("/prometheus_webhook_event", webhookHandler(client.SendEventsContext, token))
+	p2mServer.POST("/grafana_webhook_event", webhookHandler(client.SendGrafanaEvents, token))
+
+	genericInputs := map[string]p2mclient.GenericInput{}
+	for _, input := range config.GenericInputs {
+		genericInputs[input.Name] = input
+	}
+
+	p2mServer.POST("/generic_webhook_event/:name", func(c *gin.Context) {
+		input, ok := genericInputs[c.Param("name")]
+		if !ok {
+			c.String(404, fmt.Sprintf("Unknown generic input: %s", c.Param("name")))
+			return
+		}
+
+		webhookHandler(func(ctx context.Context, payload string, token string) (int, error) {
+			return client.SendGenericEvents(ctx, input, payload, token)
+		}, token)(c)
+	})
+
+	if envBool("MOOGSOFT_CALLBACK_ENABLED", false) {
+		alertmanagerURL := os.Getenv("ALERTMANAGER_URL")
+		if alertmanagerURL == "" {
+			exitOnError(errors.New("ALERTMANAGER_URL is required when MOOGSOFT_CALLBACK_ENABLED is set"))
+		}
+
+		callbackToken := os.Getenv("MOOGSOFT_CALLBACK_TOKEN")
+		if callbackToken == "" {
+			exitOnError(errors.New("MOOGSOFT_CALLBACK_TOKEN is required when MOOGSOFT_CALLBACK_ENABLED is set"))
+		}
+
+		// The callbacks look the alerts up in the registry, which only the
+		// first instance completes by reconciling with alertmanager.
+		if !firstInstance() {
+			slog.Info("Not handling moogsoft callbacks, only the first instance does", "instance_index", os.Getenv("CF_INSTANCE_INDEX"))
+			p2mServer.POST("/moogsoft_callback", requireBearerToken(callbackToken), func(c *gin.Context) {
+				c.String(503, "Moogsoft callbacks are only handled by the first instance")
+			})
+		} else {
+			silencer := p2mclient.NewSilencer(alertmanagerURL, &client, envDuration("ALERTMANAGER_SILENCE_DURATION", 24*time.Hour))
+			silencer.HTTPClient = &http.Client{Timeout: envDuration("ALERTMANAGER_TIMEOUT", 10*time.Second)}
+			client.Silencer = silencer
+
+			p2mServer.POST("/moogsoft_callback", requireBearerToken(callbackToken), func(c *gin.Context) {
+				var callback p2mclient.MoogsoftCallback
+				if err := c.BindJSON(&callback); err != nil {
+					return
+				}
+
+				err := silencer.Handle(c.Request.Context(), callback)
+				switch {
+				case err == p2mclient.ErrUnknownSignature:
+					c.String(404, err.Error())
+				case errors.Is(err, p2mclient.ErrUnknownAction):
+					c.String(400, err.Error())
+				case err != nil:
+					c.String(502, err.Error())
+				default:
+					c.String(200, "callback handled")
+				}
+			})
+		}
+	}
+
+	p2mServer.Run(fmt.Sprintf(":%s", opts.Port))
+}
+
+// webhookHandler returns a handler passing the request body to send.
+func webhookHandler(send func(ctx context.Context, payload string, token string) (int, error), token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
 		body, _ := c.GetRawData()
 
-		responseCode, err := client.SendEvents(string(body), token)
+		responseCode, err := send(c.Request.Context(), string(body), token)
 
 		if err != nil {
 			c.String(responseCode, err.Error())
-
-			fmt.Println(err.Error())
 		} else {
 			c.String(responseCode, "events sent")
 		}
-	})
+	}
+}
 
-	p2mServer.Run(fmt.Sprintf(":%s", opts.Port))
+// requireBearerToken answers with 401 the requests not authorized by the
+// bearer token, compared in constant time.
+func requireBearerToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte("Bearer "+token)) != 1 {
+			c.String(401, "Invalid bearer token")
+			c.Abort()
+		}
+	}
+}
+
+// requestLogger tags every request with a request id, taken from the
+// X-Request-ID header when present, and logs it once served.
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(p2mclient.RequestIDHeader)
+		if requestID == "" {
+			requestID = p2mclient.NewRequestID()
+		}
+
+		c.Request = c.Request.WithContext(p2mclient.WithRequestID(c.Request.Context(), requestID))
+		c.Header(p2mclient.RequestIDHeader, requestID)
+
+		c.Next()
+
+		slog.Info("Served request",
+			"request_id", requestID,
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status_code", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+func logLevel() slog.Level {
+	if os.Getenv("DEBUG") != "" {
+		return slog.LevelDebug
+	}
+
+	var level slog.Level
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		exitOnInvalidEnv("LOG_LEVEL", level.UnmarshalText([]byte(value)))
+	}
+
+	return level
+}
+
+func newAuthenticator(mode string, credential func(name string) p2mclient.Credential) p2mclient.Authenticator {
+	switch mode {
+	case "", "basic-token":
+		return p2mclient.BasicTokenAuth{Token: credential("MOOGSOFT_TOKEN")}
+	case "basic":
+		return p2mclient.BasicAuth{
+			Username: credential("MOOGSOFT_USERNAME"),
+			Password: credential("MOOGSOFT_PASSWORD"),
+		}
+	case "bearer":
+		return p2mclient.BearerAuth{Token: credential("MOOGSOFT_TOKEN")}
+	case "header":
+		if os.Getenv("MOOGSOFT_AUTH_HEADER") == "" {
+			exitOnError(fmt.Errorf("MOOGSOFT_AUTH_HEADER is required with the header auth mode"))
+		}
+		return p2mclient.HeaderAuth{
+			Header: os.Getenv("MOOGSOFT_AUTH_HEADER"),
+			Token:  credential("MOOGSOFT_TOKEN"),
+		}
+	default:
+		exitOnError(fmt.Errorf("Unsupported MOOGSOFT_AUTH_MODE: %s", mode))
+		return nil
+	}
 }
@@ -0,0 +1,113 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bonzofenix/prometheus2moogsoft/client"
+)
+
+// Sources a secret can be loaded from.
+const (
+	SourceNone = "none"
+	SourceEnv  = "env"
+	SourceFile = "file"
+	SourceVCAP = "vcap_services"
+)
+
+type vcapService struct {
+	Name        string                 `json:"name"`
+	Tags        []string               `json:"tags"`
+	Credentials map[string]interface{} `json:"credentials"`
+}
+
+// Resolver looks up secrets in files, environment variables and the
+// credentials of a service bound to the app on Cloud Foundry.
+type Resolver struct {
+	credentials map[string]interface{}
+}
+
+// NewResolver returns a resolver using the credentials of the service named
+// or tagged serviceName found in VCAP_SERVICES, if any. A service named
+// serviceName wins over the tagged ones, and several services matching
+// equally are an error rather than an arbitrary pick.
+func NewResolver(serviceName string) (*Resolver, error) {
+	r := &Resolver{}
+
+	vcapServices := os.Getenv("VCAP_SERVICES")
+	if vcapServices == "" {
+		return r, nil
+	}
+
+	var services map[string][]vcapService
+	if err := json.Unmarshal([]byte(vcapServices), &services); err != nil {
+		return nil, fmt.Errorf("Invalid VCAP_SERVICES: %s", err.Error())
+	}
+
+	var named, tagged []vcapService
+	for _, instances := range services {
+		for _, service := range instances {
+			if service.Name == serviceName {
+				named = append(named, service)
+			} else if contains(service.Tags, serviceName) {
+				tagged = append(tagged, service)
+			}
+		}
+	}
+
+	matches := named
+	if len(matches) == 0 {
+		matches = tagged
+	}
+
+	switch len(matches) {
+	case 0:
+		return r, nil
+	case 1:
+		r.credentials = matches[0].Credentials
+		return r, nil
+	}
+
+	names := make([]string, len(matches))
+	for i, service := range matches {
+		names[i] = service.Name
+	}
+	sort.Strings(names)
+
+	return nil, fmt.Errorf("Several services bound as %s in VCAP_SERVICES: %s", serviceName, strings.Join(names, ", "))
+}
+
+// Resolve returns the secret for the environment variable name and where it
+// was found. A file set in the variable with the _FILE suffix comes first,
+// then the variable itself and last the bound service credential named like
+// the variable in lower case.
+func (r *Resolver) Resolve(name string) (client.Credential, string) {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		return client.NewFileCredential(path), SourceFile
+	}
+
+	if value := os.Getenv(name); value != "" {
+		return client.StaticCredential(value), SourceEnv
+	}
+
+	for _, key := range []string{name, strings.ToLower(name)} {
+		if value, ok := r.credentials[key]; ok {
+			return client.StaticCredential(fmt.Sprintf("%v", value)), SourceVCAP
+		}
+	}
+
+	return client.StaticCredential(""), SourceNone
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,149 @@
+package secrets_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/bonzofenix/prometheus2moogsoft/secrets"
+)
+
+var _ = Describe("Resolver", func() {
+	var resolver *Resolver
+	var err error
+
+	BeforeEach(func() {
+		os.Setenv("VCAP_SERVICES", `{
+      "user-provided": [
+        { "name": "other-service", "credentials": { "moogsoft_token": "wrong-token" } },
+        { "name": "moogsoft", "tags": [], "credentials": { "moogsoft_token": "vcap-token" } }
+      ]
+    }`)
+		os.Unsetenv("MOOGSOFT_TOKEN")
+		os.Unsetenv("MOOGSOFT_TOKEN_FILE")
+	})
+
+	JustBeforeEach(func() {
+		resolver, err = NewResolver("moogsoft")
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("VCAP_SERVICES")
+		os.Unsetenv("MOOGSOFT_TOKEN")
+		os.Unsetenv("MOOGSOFT_TOKEN_FILE")
+	})
+
+	Context("when the secret is only in the bound service", func() {
+		It("Should read it from VCAP_SERVICES", func() {
+			credential, source := resolver.Resolve("MOOGSOFT_TOKEN")
+			Expect(source).Should(Equal(SourceVCAP))
+			Expect(credential.Value()).Should(Equal("vcap-token"))
+		})
+	})
+
+	Context("when the service is bound by tag", func() {
+		BeforeEach(func() {
+			os.Setenv("VCAP_SERVICES", `{
+        "user-provided": [
+          { "name": "p2m-creds", "tags": ["moogsoft"], "credentials": { "MOOGSOFT_TOKEN": "tagged-token" } }
+        ]
+      }`)
+		})
+
+		It("Should read it from the tagged service", func() {
+			credential, source := resolver.Resolve("MOOGSOFT_TOKEN")
+			Expect(source).Should(Equal(SourceVCAP))
+			Expect(credential.Value()).Should(Equal("tagged-token"))
+		})
+	})
+
+	Context("when the secret is set in the environment", func() {
+		BeforeEach(func() { os.Setenv("MOOGSOFT_TOKEN", "env-token") })
+
+		It("Should prefer the environment over VCAP_SERVICES", func() {
+			credential, source := resolver.Resolve("MOOGSOFT_TOKEN")
+			Expect(source).Should(Equal(SourceEnv))
+			Expect(credential.Value()).Should(Equal("env-token"))
+		})
+	})
+
+	Context("when the secret is in a file", func() {
+		var path string
+
+		BeforeEach(func() {
+			os.Setenv("MOOGSOFT_TOKEN", "env-token")
+
+			f, err := ioutil.TempFile("", "moogsoft-token")
+			Expect(err).ShouldNot(HaveOccurred())
+			f.WriteString("file-token")
+			f.Close()
+			path = f.Name()
+
+			os.Setenv("MOOGSOFT_TOKEN_FILE", path)
+		})
+
+		AfterEach(func() { os.Remove(path) })
+
+		It("Should prefer the file", func() {
+			credential, source := resolver.Resolve("MOOGSOFT_TOKEN")
+			Expect(source).Should(Equal(SourceFile))
+			Expect(credential.Value()).Should(Equal("file-token"))
+		})
+	})
+
+	Context("when the secret is nowhere", func() {
+		It("Should report no source", func() {
+			credential, source := resolver.Resolve("MOOGSOFT_PASSWORD")
+			Expect(source).Should(Equal(SourceNone))
+			Expect(credential.Value()).Should(BeEmpty())
+		})
+	})
+
+	Context("when VCAP_SERVICES is invalid", func() {
+		It("Should return an error", func() {
+			os.Setenv("VCAP_SERVICES", "not json")
+			_, err := NewResolver("moogsoft")
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("NewResolver", func() {
+	AfterEach(func() { os.Unsetenv("VCAP_SERVICES") })
+
+	Context("when a service is named and another tagged", func() {
+		It("Should use the named service", func() {
+			os.Setenv("VCAP_SERVICES", `{
+        "user-provided": [
+          { "name": "p2m-creds", "tags": ["moogsoft"], "credentials": { "moogsoft_token": "tagged-token" } }
+        ],
+        "moogsoft-broker": [
+          { "name": "moogsoft", "credentials": { "moogsoft_token": "named-token" } }
+        ]
+      }`)
+
+			resolver, err := NewResolver("moogsoft")
+			Expect(err).ShouldNot(HaveOccurred())
+
+			credential, _ := resolver.Resolve("MOOGSOFT_TOKEN")
+			Expect(credential.Value()).Should(Equal("named-token"))
+		})
+	})
+
+	Context("when several services are tagged", func() {
+		It("Should refuse to pick one", func() {
+			os.Setenv("VCAP_SERVICES", `{
+        "user-provided": [
+          { "name": "creds-b", "tags": ["moogsoft"], "credentials": { "moogsoft_token": "b" } },
+          { "name": "creds-a", "tags": ["moogsoft"], "credentials": { "moogsoft_token": "a" } }
+        ]
+      }`)
+
+			_, err := NewResolver("moogsoft")
+			Expect(err).Should(MatchError("Several services bound as moogsoft in VCAP_SERVICES: creds-a, creds-b"))
+		})
+	})
+})